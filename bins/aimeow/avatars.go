@@ -0,0 +1,309 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/types"
+)
+
+// Avatar sizes served by the proxy
+const (
+	AvatarSizeFull    = "full"
+	AvatarSizePreview = "preview"
+)
+
+const (
+	// avatarRevalidateAfter is how old a cached picture can get before WhatsApp is asked
+	// whether it changed. Picture events usually refresh it sooner.
+	avatarRevalidateAfter = 24 * time.Hour
+
+	// avatarMissingTTL is how long "no picture" is remembered before asking again
+	avatarMissingTTL = 6 * time.Hour
+
+	avatarMaxBytes = 5 << 20
+
+	// avatarMissingMarker is the file that records a contact without a visible picture
+	avatarMissingMarker = "none"
+)
+
+var errAvatarNotFound = errors.New("no profile picture")
+
+var avatarHTTPClient = &http.Client{Timeout: 30 * time.Second}
+
+// avatarDir is where the cached pictures of one contact are kept
+func avatarDir(clientID string, jid types.JID) string {
+	return filepath.Join(dataDir, "avatars", clientID, jid.ToNonAD().String())
+}
+
+// avatarURL is the stable URL that serves a contact's cached picture
+func avatarURL(clientID string, jid types.JID, size string) string {
+	u := fmt.Sprintf("%s/avatars/%s/%s", baseURL, clientID, url.PathEscape(jid.ToNonAD().String()))
+	if size == AvatarSizePreview {
+		u += "?size=" + AvatarSizePreview
+	}
+	return u
+}
+
+// findCachedAvatar returns the cached file and picture ID for a size, if any.
+// Files are named <pictureID>-<size>.jpg.
+func findCachedAvatar(dir string, size string) (path string, pictureID string, modTime time.Time) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return "", "", time.Time{}
+	}
+	suffix := "-" + size + ".jpg"
+	for _, entry := range entries {
+		name := entry.Name()
+		if !strings.HasSuffix(name, suffix) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		return filepath.Join(dir, name), strings.TrimSuffix(name, suffix), info.ModTime()
+	}
+	return "", "", time.Time{}
+}
+
+// avatarLock serializes fetches of the same contact's picture
+func (client *WhatsAppClient) avatarLock(key string) *sync.Mutex {
+	client.avatarMutex.Lock()
+	defer client.avatarMutex.Unlock()
+
+	lock, exists := client.avatarLocks[key]
+	if !exists {
+		lock = &sync.Mutex{}
+		client.avatarLocks[key] = lock
+	}
+	return lock
+}
+
+// getAvatar returns the path and picture ID of a contact's cached picture, downloading it
+// from WhatsApp when it isn't cached yet or is due for revalidation
+func (cm *ClientManager) getAvatar(client *WhatsAppClient, clientID string, jid types.JID, size string) (string, string, error) {
+	dir := avatarDir(clientID, jid)
+	lock := client.avatarLock(dir)
+	lock.Lock()
+	defer lock.Unlock()
+
+	if info, err := os.Stat(filepath.Join(dir, avatarMissingMarker)); err == nil && time.Since(info.ModTime()) < avatarMissingTTL {
+		return "", "", errAvatarNotFound
+	}
+
+	path, pictureID, modTime := findCachedAvatar(dir, size)
+	if path != "" && time.Since(modTime) < avatarRevalidateAfter {
+		return path, pictureID, nil
+	}
+
+	// Ask WhatsApp for the picture; passing the cached ID makes it answer "unchanged" cheaply
+	picture, err := client.client.GetProfilePictureInfo(context.Background(), jid, &whatsmeow.GetProfilePictureParams{
+		Preview:    size == AvatarSizePreview,
+		ExistingID: pictureID,
+	})
+	switch {
+	case errors.Is(err, whatsmeow.ErrProfilePictureNotSet) || errors.Is(err, whatsmeow.ErrProfilePictureUnauthorized):
+		clearAvatarDir(dir)
+		if err := os.MkdirAll(dir, 0755); err == nil {
+			os.WriteFile(filepath.Join(dir, avatarMissingMarker), nil, 0644)
+		}
+		return "", "", errAvatarNotFound
+	case err != nil:
+		if path != "" {
+			// Serve the stale copy rather than a broken image
+			LogMedia.Warn("Failed to revalidate avatar of %s for client %s: %v", jid.String(), clientID, err)
+			return path, pictureID, nil
+		}
+		return "", "", err
+	case picture == nil:
+		// Unchanged since we cached it
+		now := time.Now()
+		os.Chtimes(path, now, now)
+		return path, pictureID, nil
+	}
+
+	data, err := downloadAvatar(picture.URL)
+	if err != nil {
+		if path != "" {
+			LogMedia.Warn("Failed to download new avatar of %s for client %s: %v", jid.String(), clientID, err)
+			return path, pictureID, nil
+		}
+		return "", "", err
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", "", err
+	}
+	newPath := filepath.Join(dir, picture.ID+"-"+size+".jpg")
+	tempPath := newPath + ".tmp"
+	if err := os.WriteFile(tempPath, data, 0644); err != nil {
+		return "", "", err
+	}
+	if err := os.Rename(tempPath, newPath); err != nil {
+		return "", "", err
+	}
+	if path != "" && path != newPath {
+		os.Remove(path)
+	}
+	os.Remove(filepath.Join(dir, avatarMissingMarker))
+
+	LogMedia.Info("Cached %s avatar of %s for client %s (%s)", size, jid.String(), clientID, picture.ID)
+	return newPath, picture.ID, nil
+}
+
+// downloadAvatar fetches a picture from the WhatsApp CDN
+func downloadAvatar(pictureURL string) ([]byte, error) {
+	resp, err := avatarHTTPClient.Get(pictureURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download avatar: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("avatar download failed with status: %d", resp.StatusCode)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, avatarMaxBytes+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read avatar: %w", err)
+	}
+	if len(data) > avatarMaxBytes {
+		return nil, errors.New("avatar is too large")
+	}
+	return data, nil
+}
+
+// clearAvatarDir removes every cached picture of a contact
+func clearAvatarDir(dir string) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		os.Remove(filepath.Join(dir, entry.Name()))
+	}
+}
+
+// handlePictureEvent refreshes the cached picture of a contact after WhatsApp reports a change
+func (cm *ClientManager) handlePictureEvent(client *WhatsAppClient, clientID string, jid types.JID, removed bool) {
+	if clientID == "" {
+		return
+	}
+
+	dir := avatarDir(clientID, jid)
+	if _, err := os.Stat(dir); err != nil {
+		// Nothing cached for this contact, so nothing to refresh
+		return
+	}
+
+	lock := client.avatarLock(dir)
+	lock.Lock()
+	var sizes []string
+	for _, size := range []string{AvatarSizeFull, AvatarSizePreview} {
+		if path, _, _ := findCachedAvatar(dir, size); path != "" {
+			sizes = append(sizes, size)
+		}
+	}
+	clearAvatarDir(dir)
+	if removed {
+		os.WriteFile(filepath.Join(dir, avatarMissingMarker), nil, 0644)
+	}
+	lock.Unlock()
+
+	if removed {
+		LogMedia.Info("Avatar of %s removed for client %s", jid.String(), clientID)
+		return
+	}
+
+	// Re-download the sizes that were in use so the next request is served from disk
+	for _, size := range sizes {
+		if _, _, err := cm.getAvatar(client, clientID, jid, size); err != nil && !errors.Is(err, errAvatarNotFound) {
+			LogMedia.Warn("Failed to refresh %s avatar of %s for client %s: %v", size, jid.String(), clientID, err)
+		}
+	}
+}
+
+// purgeClientAvatars removes a client's avatar cache
+func purgeClientAvatars(clientID string) error {
+	return os.RemoveAll(filepath.Join(dataDir, "avatars", clientID))
+}
+
+// @Summary Get cached profile picture
+// @Description Serves a contact's or group's profile picture from the local cache, downloading it from WhatsApp when needed. The URL is stable, unlike WhatsApp CDN URLs.
+// @Tags contacts
+// @Produce image/jpeg
+// @Param client_id path string true "Client ID"
+// @Param jid path string true "Phone number or JID"
+// @Param size query string false "full (default) or preview"
+// @Success 200 {file} file "Profile picture"
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 502 {object} map[string]string
+// @Router /avatars/{client_id}/{jid} [get]
+func getAvatarHandler(c *gin.Context) {
+	clientID := c.Param("client_id")
+
+	waClient, err := manager.getClient(clientID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "client not found"})
+		return
+	}
+
+	size := c.DefaultQuery("size", AvatarSizeFull)
+	if size != AvatarSizeFull && size != AvatarSizePreview {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "size must be full or preview"})
+		return
+	}
+
+	jid, err := parseChatJID(clientID, c.Param("jid"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !waClient.isConnected {
+		// Serve what we have while offline
+		if path, pictureID, _ := findCachedAvatar(avatarDir(clientID, jid), size); path != "" {
+			serveAvatar(c, path, pictureID)
+			return
+		}
+		c.JSON(http.StatusNotFound, gin.H{"error": "profile picture not cached and client is not connected"})
+		return
+	}
+
+	path, pictureID, err := manager.getAvatar(waClient, clientID, jid, size)
+	if errors.Is(err, errAvatarNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "no profile picture"})
+		return
+	} else if err != nil {
+		LogMedia.Error("Failed to get avatar of %s for client %s: %v", jid.String(), clientID, err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	}
+
+	serveAvatar(c, path, pictureID)
+}
+
+func serveAvatar(c *gin.Context, path string, pictureID string) {
+	etag := `"` + pictureID + `"`
+	c.Header("ETag", etag)
+	c.Header("Cache-Control", "public, max-age=3600")
+	if c.GetHeader("If-None-Match") == etag {
+		c.Status(http.StatusNotModified)
+		return
+	}
+	c.Header("Content-Type", "image/jpeg")
+	c.File(path)
+}
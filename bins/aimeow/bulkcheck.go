@@ -0,0 +1,306 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Bulk registration check limits. WhatsApp rate limits contact queries, so large lists are
+// split into batches with a pause between them. The request is answered synchronously, so the
+// maximum keeps a full check (20 batches, 38s of pauses) well inside common proxy timeouts.
+const (
+	bulkCheckMaxNumbers = 1000
+	bulkCheckBatchSize  = 50
+	bulkCheckBatchDelay = 2 * time.Second
+)
+
+// BulkCheckWhatsAppRequest lists phone numbers to check. Numbers starting with a national
+// trunk prefix (0) are rewritten with defaultCountryCode when it is set.
+type BulkCheckWhatsAppRequest struct {
+	Phones             []string `json:"phones" binding:"required,min=1"`
+	DefaultCountryCode string   `json:"defaultCountryCode,omitempty" binding:"omitempty,numeric"`
+}
+
+type BulkCheckResult struct {
+	Input        string `json:"input"`
+	Phone        string `json:"phone,omitempty"` // Normalized number without +
+	IsRegistered bool   `json:"isRegistered"`
+	JID          string `json:"jid,omitempty"`
+	IsBusiness   bool   `json:"isBusiness"`
+	VerifiedName string `json:"verifiedName,omitempty"`
+	Error        string `json:"error,omitempty"`
+}
+
+type BulkCheckWhatsAppResponse struct {
+	Total      int               `json:"total"`
+	Registered int               `json:"registered"`
+	Invalid    int               `json:"invalid"`
+	Results    []BulkCheckResult `json:"results"`
+}
+
+// normalizePhone strips formatting from a phone number and returns its digits in international form
+func normalizePhone(phone string, defaultCountryCode string) (string, error) {
+	phone = strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(phone), "@s.whatsapp.net"))
+	international := strings.HasPrefix(phone, "+")
+
+	var digits strings.Builder
+	for _, r := range phone {
+		switch {
+		case r >= '0' && r <= '9':
+			digits.WriteRune(r)
+		case r == '+' || r == '-' || r == ' ' || r == '(' || r == ')' || r == '.':
+			// Formatting characters
+		default:
+			return "", fmt.Errorf("invalid character %q", r)
+		}
+	}
+	number := digits.String()
+
+	switch {
+	case international:
+	case strings.HasPrefix(number, "00"):
+		number = number[2:]
+	case strings.HasPrefix(number, "0") && defaultCountryCode != "":
+		number = defaultCountryCode + number[1:]
+	}
+
+	// E.164 allows at most 15 digits; anything under 7 can't be a full international number
+	if len(number) < 7 || len(number) > 15 {
+		return "", errors.New("not a valid international phone number")
+	}
+	return number, nil
+}
+
+// readBulkCheckCSV reads phone numbers from the first column of a CSV body, skipping a header row
+func readBulkCheckCSV(r io.Reader) ([]string, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	var phones []string
+	for line := 0; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid CSV: %w", err)
+		}
+		if len(record) == 0 || strings.TrimSpace(record[0]) == "" {
+			continue
+		}
+		if line == 0 && strings.IndexAny(record[0], "0123456789") < 0 {
+			continue
+		}
+		phones = append(phones, record[0])
+	}
+	return phones, nil
+}
+
+// readBulkCheckRequest accepts JSON, a text/csv body or a multipart "file" upload
+func readBulkCheckRequest(c *gin.Context) (BulkCheckWhatsAppRequest, error) {
+	var req BulkCheckWhatsAppRequest
+
+	switch {
+	case strings.HasPrefix(c.ContentType(), "multipart/"):
+		file, err := c.FormFile("file")
+		if err != nil {
+			return req, fmt.Errorf("missing CSV file: %w", err)
+		}
+		f, err := file.Open()
+		if err != nil {
+			return req, fmt.Errorf("failed to open CSV file: %w", err)
+		}
+		defer f.Close()
+		if req.Phones, err = readBulkCheckCSV(f); err != nil {
+			return req, err
+		}
+		req.DefaultCountryCode = c.PostForm("defaultCountryCode")
+	case c.ContentType() == "text/csv":
+		var err error
+		if req.Phones, err = readBulkCheckCSV(c.Request.Body); err != nil {
+			return req, err
+		}
+		req.DefaultCountryCode = c.Query("defaultCountryCode")
+	default:
+		if err := c.ShouldBindJSON(&req); err != nil {
+			return req, err
+		}
+	}
+
+	if len(req.Phones) == 0 {
+		return req, errors.New("no phone numbers given")
+	}
+	if len(req.Phones) > bulkCheckMaxNumbers {
+		return req, fmt.Errorf("too many phone numbers: %d (max %d)", len(req.Phones), bulkCheckMaxNumbers)
+	}
+	if req.DefaultCountryCode != "" {
+		if _, err := strconv.Atoi(req.DefaultCountryCode); err != nil {
+			return req, errors.New("defaultCountryCode must be numeric")
+		}
+	}
+	return req, nil
+}
+
+// bulkCheckWhatsApp normalizes the numbers and queries WhatsApp in paced batches
+func bulkCheckWhatsApp(ctx context.Context, waClient *WhatsAppClient, clientID string, req BulkCheckWhatsAppRequest) BulkCheckWhatsAppResponse {
+	resp := BulkCheckWhatsAppResponse{
+		Total:   len(req.Phones),
+		Results: make([]BulkCheckResult, len(req.Phones)),
+	}
+
+	// Normalize and dedupe; several inputs may map to the same number
+	indexes := make(map[string][]int)
+	var queue []string
+	for i, input := range req.Phones {
+		resp.Results[i].Input = input
+		phone, err := normalizePhone(input, req.DefaultCountryCode)
+		if err != nil {
+			resp.Results[i].Error = err.Error()
+			resp.Invalid++
+			continue
+		}
+		resp.Results[i].Phone = phone
+		if _, seen := indexes[phone]; !seen {
+			queue = append(queue, phone)
+		}
+		indexes[phone] = append(indexes[phone], i)
+	}
+
+	for start := 0; start < len(queue); start += bulkCheckBatchSize {
+		if start > 0 {
+			select {
+			case <-ctx.Done():
+				for _, phone := range queue[start:] {
+					for _, i := range indexes[phone] {
+						resp.Results[i].Error = "request cancelled"
+					}
+				}
+				return resp
+			case <-time.After(bulkCheckBatchDelay):
+			}
+		}
+
+		end := start + bulkCheckBatchSize
+		if end > len(queue) {
+			end = len(queue)
+		}
+		batch := queue[start:end]
+
+		queries := make([]string, len(batch))
+		for i, phone := range batch {
+			queries[i] = "+" + phone
+		}
+
+		results, err := waClient.client.IsOnWhatsApp(ctx, queries)
+		if err != nil {
+			LogClient.Error("Bulk check batch %d-%d failed for client %s: %v", start, end, clientID, err)
+			for _, phone := range batch {
+				for _, i := range indexes[phone] {
+					resp.Results[i].Error = fmt.Sprintf("Failed to check: %v", err)
+				}
+			}
+			continue
+		}
+
+		for _, info := range results {
+			phone := strings.TrimPrefix(info.Query, "+")
+			for _, i := range indexes[phone] {
+				result := &resp.Results[i]
+				result.IsRegistered = info.IsIn
+				if info.IsIn {
+					result.JID = info.JID.String()
+				}
+				if info.VerifiedName != nil {
+					result.IsBusiness = true
+					result.VerifiedName = info.VerifiedName.Details.GetVerifiedName()
+				}
+			}
+		}
+	}
+
+	for _, result := range resp.Results {
+		if result.IsRegistered {
+			resp.Registered++
+		}
+	}
+
+	LogClient.Info("Bulk check for client %s: %d numbers, %d registered, %d invalid",
+		clientID, resp.Total, resp.Registered, resp.Invalid)
+	return resp
+}
+
+// writeBulkCheckCSV writes the results as CSV with a header row
+func writeBulkCheckCSV(c *gin.Context, resp BulkCheckWhatsAppResponse) {
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Header("Content-Disposition", `attachment; filename="check-whatsapp.csv"`)
+	c.Status(http.StatusOK)
+
+	writer := csv.NewWriter(c.Writer)
+	writer.Write([]string{"input", "phone", "is_registered", "jid", "is_business", "verified_name", "error"})
+	for _, result := range resp.Results {
+		writer.Write([]string{
+			result.Input,
+			result.Phone,
+			strconv.FormatBool(result.IsRegistered),
+			result.JID,
+			strconv.FormatBool(result.IsBusiness),
+			result.VerifiedName,
+			result.Error,
+		})
+	}
+	writer.Flush()
+}
+
+// @Summary Check many phone numbers on WhatsApp
+// @Description Normalizes up to 1000 phone numbers and checks which are registered on WhatsApp, in paced batches. Accepts JSON, a text/csv body or a multipart "file" upload (numbers in the first column). Returns CSV with ?format=csv or Accept: text/csv.
+// @Tags contacts
+// @Accept json,plain,mpfd
+// @Produce json,plain
+// @Param id path string true "Client ID"
+// @Param request body BulkCheckWhatsAppRequest false "Phone numbers"
+// @Param format query string false "Response format (json or csv)"
+// @Success 200 {object} BulkCheckWhatsAppResponse
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /clients/{id}/check-whatsapp [post]
+func bulkCheckWhatsAppHandler(c *gin.Context) {
+	clientID := c.Param("id")
+
+	waClient, err := manager.getClient(clientID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !waClient.isConnected {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "client is not connected"})
+		return
+	}
+
+	req, err := readBulkCheckRequest(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.DefaultCountryCode == "" {
+		req.DefaultCountryCode = manager.countryCodeFor(clientID)
+	}
+	resp := bulkCheckWhatsApp(c.Request.Context(), waClient, clientID, req)
+
+	if c.Query("format") == "csv" || strings.Contains(c.GetHeader("Accept"), "text/csv") {
+		writeBulkCheckCSV(c, resp)
+		return
+	}
+	c.JSON(http.StatusOK, resp)
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+	"google.golang.org/protobuf/proto"
+)
+
+// newCallData builds the common webhook fields for a call event
+func newCallData(meta types.BasicCallMeta) CallData {
+	data := CallData{
+		CallID:    meta.CallID,
+		From:      meta.From.ToNonAD().String(),
+		Timestamp: meta.Timestamp.Unix(),
+	}
+	if !meta.CallCreator.IsEmpty() {
+		data.Creator = meta.CallCreator.ToNonAD().String()
+	}
+	if !meta.CallCreatorAlt.IsEmpty() {
+		data.CreatorAlt = meta.CallCreatorAlt.ToNonAD().String()
+	}
+	if !meta.GroupJID.IsEmpty() {
+		data.GroupJID = meta.GroupJID.String()
+	}
+	return data
+}
+
+// callLane orders a call's events with the rest of the caller's chat
+func callLane(meta types.BasicCallMeta) string {
+	if !meta.GroupJID.IsEmpty() {
+		return meta.GroupJID.String()
+	}
+	return meta.From.ToNonAD().String()
+}
+
+// handleIncomingCall reports a call and rejects it if the client's settings say so
+func (cm *ClientManager) handleIncomingCall(client *WhatsAppClient, clientID string, meta types.BasicCallMeta, media string, isGroup bool) {
+	if clientID == "" {
+		return
+	}
+
+	settings := cm.getClientSettings(clientID)
+
+	payload := CallIncomingData{CallData: newCallData(meta), Media: media, IsGroup: isGroup}
+
+	if settings.RejectCalls {
+		if err := client.client.RejectCall(context.Background(), meta.From, meta.CallID); err != nil {
+			LogClient.Error("Failed to reject call %s from %s for client %s: %v", meta.CallID, meta.From.String(), clientID, err)
+			payload.RejectError = err.Error()
+		} else {
+			LogClient.Info("Rejected %s call %s from %s for client %s", media, meta.CallID, meta.From.String(), clientID)
+			payload.Rejected = true
+
+			if settings.CallRejectMessage != "" {
+				cm.sendCallRejectReply(client, clientID, meta, settings.CallRejectMessage)
+			}
+		}
+	} else {
+		LogClient.Info("Incoming %s call %s from %s for client %s", media, meta.CallID, meta.From.String(), clientID)
+	}
+
+	cm.sendConnectionStatusWebhook(clientID, "call.incoming", payload)
+}
+
+// sendCallRejectReply tells the caller why the call was declined. For group calls too it goes to the
+// caller's own chat, so the other members don't all get it.
+func (cm *ClientManager) sendCallRejectReply(client *WhatsAppClient, clientID string, meta types.BasicCallMeta, text string) {
+	chat := meta.From.ToNonAD()
+
+	msg := &waE2E.Message{
+		Conversation: proto.String(text),
+	}
+	if _, err := client.client.SendMessage(context.Background(), chat, msg); err != nil {
+		LogClient.Error("Failed to send call reject reply to %s for client %s: %v", chat.String(), clientID, err)
+	}
+}
+
+// handleCallEvent converts the other call events into webhooks. data is CallData or embeds it.
+func (cm *ClientManager) handleCallEvent(clientID string, event string, data interface{}) {
+	if clientID == "" {
+		return
+	}
+	cm.sendConnectionStatusWebhook(clientID, event, data)
+}
+
+// callMedia tells voice and video calls apart from the offer node
+func callMedia(evt *events.CallOffer) string {
+	if evt.Data != nil {
+		if _, isVideo := evt.Data.GetOptionalChildByTag("video"); isVideo {
+			return "video"
+		}
+	}
+	return "audio"
+}
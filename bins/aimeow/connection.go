@@ -0,0 +1,317 @@
+package main
+
+import (
+	"context"
+	"math/rand"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ConnectionState is the lifecycle state of a WhatsApp client
+type ConnectionState string
+
+const (
+	StatePairing      ConnectionState = "pairing"
+	StateConnecting   ConnectionState = "connecting"
+	StateConnected    ConnectionState = "connected"
+	StateReconnecting ConnectionState = "reconnecting"
+	StateDisconnected ConnectionState = "disconnected"
+	StateLoggedOut    ConnectionState = "logged_out"
+	StateBanned       ConnectionState = "banned"
+)
+
+// Reconnect backoff bounds
+const (
+	reconnectBaseDelay = 2 * time.Second
+	reconnectMaxDelay  = 5 * time.Minute
+
+	// keepAliveReconnectThreshold is the number of consecutive keepalive timeouts
+	// after which the socket is considered dead and forcibly reconnected
+	keepAliveReconnectThreshold = 3
+)
+
+// clientIDFor returns the UUID under which a client is registered. Caller must not hold cm.mutex.
+func (cm *ClientManager) clientIDFor(client *WhatsAppClient) string {
+	cm.mutex.RLock()
+	defer cm.mutex.RUnlock()
+
+	if client.deviceStore.ID != nil {
+		if clientID, exists := cm.clientIDMap[client.deviceStore.ID.String()]; exists {
+			return clientID
+		}
+	}
+	for uuid, c := range cm.clients {
+		if c == client {
+			return uuid
+		}
+	}
+	return ""
+}
+
+// setState records a state transition and sends a state_changed webhook.
+// Caller must hold client.mutex.
+func (cm *ClientManager) setState(client *WhatsAppClient, clientID string, state ConnectionState, reason string, data StateChangedData) {
+	previous := client.state
+	if previous == state && client.stateReason == reason {
+		return
+	}
+
+	now := time.Now()
+	client.state = state
+	client.stateReason = reason
+	client.stateChangedAt = &now
+
+	client.isConnected = state == StateConnected
+	if state != StateConnected {
+		client.connectedAt = nil
+	}
+	if state != StateReconnecting && state != StateBanned {
+		client.nextReconnectAt = nil
+	}
+
+	LogClient.Info("Client %s state %s -> %s (%s)", clientID, previous, state, reason)
+
+	if clientID == "" {
+		return
+	}
+
+	payload := data
+	payload.State = string(state)
+	payload.PreviousState = string(previous)
+	payload.Reason = reason
+	payload.ReconnectAttempts = client.reconnectAttempts
+	if client.nextReconnectAt != nil {
+		payload.NextReconnectAt = client.nextReconnectAt.Unix()
+	}
+	client.events.post(eventTask{lane: clientLane, run: func() {
+		cm.sendConnectionStatusWebhook(clientID, "state_changed", payload)
+	}})
+}
+
+// persistConnectedClient saves the device store and client mappings after a connection
+func (cm *ClientManager) persistConnectedClient(client *WhatsAppClient, clientID string, wasPending bool) {
+	// Saving the device store is CRITICAL for WhatsApp pairing persistence;
+	// the device JID is only known after a successful connection
+	if client.deviceStore.ID != nil {
+		if err := cm.container.PutDevice(context.Background(), client.deviceStore); err != nil {
+			LogClient.Warn("Failed to save device store after connection: %v", err)
+		} else {
+			LogClient.Info("Device store saved to database after successful connection")
+		}
+	}
+
+	if clientID == "" {
+		return
+	}
+
+	if wasPending {
+		if err := cm.savePendingClients(); err != nil {
+			LogClient.Warn("Failed to save pending clients: %v", err)
+		} else {
+			LogClient.Info("Removed client from pending list: %s", clientID)
+		}
+	}
+
+	if err := cm.saveClientMappings(); err != nil {
+		LogClient.Warn("Failed to save client mappings: %v", err)
+	} else {
+		LogConfig.Info("Saved client mapping: %s -> %s", client.deviceStore.ID.String(), clientID)
+	}
+}
+
+// reconnectDelay returns the exponential backoff delay for the given attempt, with jitter
+func reconnectDelay(attempt int) time.Duration {
+	delay := reconnectBaseDelay
+	for i := 1; i < attempt && delay < reconnectMaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > reconnectMaxDelay {
+		delay = reconnectMaxDelay
+	}
+	// Up to 20% jitter so many clients don't reconnect in lockstep
+	return delay + time.Duration(rand.Int63n(int64(delay)/5+1))
+}
+
+// scheduleReconnect arms the reconnect supervisor for a paired client.
+// Caller must hold client.mutex. A zero delay uses the backoff schedule.
+func (cm *ClientManager) scheduleReconnect(client *WhatsAppClient, clientID string, delay time.Duration, state ConnectionState, reason string, data StateChangedData) {
+	if client.reconnectTimer != nil {
+		client.reconnectTimer.Stop()
+	}
+
+	if delay == 0 {
+		client.reconnectAttempts++
+		delay = reconnectDelay(client.reconnectAttempts)
+	}
+	next := time.Now().Add(delay)
+	client.nextReconnectAt = &next
+
+	data.RetryIn = delay.String()
+	cm.setState(client, clientID, state, reason, data)
+
+	client.reconnectTimer = time.AfterFunc(delay, func() {
+		cm.reconnect(client, clientID)
+	})
+}
+
+// reconnect attempts a single reconnection, rescheduling on failure
+func (cm *ClientManager) reconnect(client *WhatsAppClient, clientID string) {
+	client.mutex.Lock()
+	client.reconnectTimer = nil
+	if client.manualDisconnect || client.deviceStore.ID == nil {
+		client.mutex.Unlock()
+		return
+	}
+	cm.setState(client, clientID, StateConnecting, "reconnect attempt", StateChangedData{})
+	client.mutex.Unlock()
+
+	LogClient.Info("Reconnecting client %s (attempt %d)", clientID, client.reconnectAttempts)
+
+	// Drop any half-dead socket before dialing again
+	client.client.Disconnect()
+	if err := client.client.Connect(); err != nil {
+		LogClient.Error("Failed to reconnect client %s: %v", clientID, err)
+		client.mutex.Lock()
+		if !client.manualDisconnect {
+			cm.scheduleReconnect(client, clientID, 0, StateReconnecting, err.Error(), StateChangedData{})
+		}
+		client.mutex.Unlock()
+	}
+}
+
+// cancelReconnect stops a pending reconnect. Caller must hold client.mutex.
+func (client *WhatsAppClient) cancelReconnect() {
+	if client.reconnectTimer != nil {
+		client.reconnectTimer.Stop()
+		client.reconnectTimer = nil
+	}
+	client.nextReconnectAt = nil
+}
+
+// connectExisting connects a paired client in the background, falling back to the reconnect supervisor
+func (cm *ClientManager) connectExisting(client *WhatsAppClient, clientID string) {
+	client.mutex.Lock()
+	client.manualDisconnect = false
+	client.cancelReconnect()
+	cm.setState(client, clientID, StateConnecting, "", StateChangedData{})
+	client.mutex.Unlock()
+
+	go func() {
+		if err := client.client.Connect(); err != nil {
+			LogClient.Error("Failed to connect client %s: %v", clientID, err)
+			client.mutex.Lock()
+			if !client.manualDisconnect {
+				cm.scheduleReconnect(client, clientID, 0, StateReconnecting, err.Error(), StateChangedData{})
+			}
+			client.mutex.Unlock()
+		} else {
+			LogClient.Info("Successfully connected client %s", clientID)
+		}
+	}()
+}
+
+// @Summary Connect client
+// @Description Connects a paired client, or restarts pairing for an unpaired one
+// @Tags clients
+// @Produce json
+// @Param id path string true "Client ID"
+// @Success 200 {object} ClientResponse
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Router /clients/{id}/connect [post]
+func connectClient(c *gin.Context) {
+	clientID := c.Param("id")
+
+	waClient, err := manager.getClient(clientID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	waClient.mutex.RLock()
+	state := waClient.state
+	waClient.mutex.RUnlock()
+
+	switch {
+	case waClient.client.IsConnected():
+		// Already connected or pairing; nothing to do
+	case waClient.deviceStore.ID == nil:
+		// Never paired, or the session was wiped by a logout
+		go manager.startPairing(clientID, waClient)
+	case state == StateLoggedOut:
+		c.JSON(http.StatusConflict, gin.H{"error": "client is logged out, delete it and pair again"})
+		return
+	default:
+		manager.connectExisting(waClient, clientID)
+	}
+
+	waClient.mutex.RLock()
+	resp := buildClientResponse(clientID, waClient)
+	waClient.mutex.RUnlock()
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// @Summary Disconnect client
+// @Description Disconnects a client without logging out; it stays disconnected until /connect is called
+// @Tags clients
+// @Produce json
+// @Param id path string true "Client ID"
+// @Success 200 {object} ClientResponse
+// @Failure 404 {object} map[string]string
+// @Router /clients/{id}/disconnect [post]
+func disconnectClient(c *gin.Context) {
+	clientID := c.Param("id")
+
+	waClient, err := manager.getClient(clientID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	waClient.mutex.Lock()
+	waClient.manualDisconnect = true
+	waClient.cancelReconnect()
+	waClient.mutex.Unlock()
+
+	waClient.client.Disconnect()
+
+	waClient.mutex.Lock()
+	if waClient.state != StateLoggedOut {
+		manager.setState(waClient, clientID, StateDisconnected, "manual disconnect", StateChangedData{})
+	}
+	resp := buildClientResponse(clientID, waClient)
+	waClient.mutex.Unlock()
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// buildClientResponse converts a client to its API representation. Caller must hold client.mutex.
+func buildClientResponse(clientID string, client *WhatsAppClient) ClientResponse {
+	resp := ClientResponse{
+		ID:                clientID,
+		IsConnected:       client.isConnected,
+		State:             string(client.state),
+		StateReason:       client.stateReason,
+		StateChangedAt:    client.stateChangedAt,
+		ReconnectAttempts: client.reconnectAttempts,
+		NextReconnectAt:   client.nextReconnectAt,
+		QRCode:            client.qrCode,
+		ConnectedAt:       client.connectedAt,
+		MessageCount:      len(client.messages),
+		OSName:            client.osName,
+		About:             client.profile.About,
+		PictureURL:        client.profile.PictureURL,
+	}
+	// Add phone number if device is connected
+	if client.deviceStore != nil && client.deviceStore.ID != nil {
+		resp.Phone = client.deviceStore.ID.User
+		resp.PushName = client.deviceStore.PushName
+	}
+	if resp.QRCode == "" {
+		resp.QRCode = "not_available"
+	}
+	return resp
+}
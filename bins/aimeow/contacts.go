@@ -0,0 +1,228 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mau.fi/whatsmeow/types"
+)
+
+// contactProfileTTL is how long a contact profile lookup is served from cache
+const contactProfileTTL = 15 * time.Minute
+
+// ContactProfile is the public profile of another WhatsApp user
+type ContactProfile struct {
+	JID          string           `json:"jid"`
+	Phone        string           `json:"phone,omitempty"`
+	LID          string           `json:"lid,omitempty"`
+	About        string           `json:"about"`
+	PictureID    string           `json:"pictureId,omitempty"`
+	VerifiedName string           `json:"verifiedName,omitempty"`
+	IsBusiness   bool             `json:"isBusiness"`
+	Business     *BusinessProfile `json:"business,omitempty"`
+	DeviceCount  int              `json:"deviceCount"`
+	FetchedAt    time.Time        `json:"fetchedAt"`
+	Cached       bool             `json:"cached"`
+}
+
+// BusinessProfile holds the details a WhatsApp Business account publishes
+type BusinessProfile struct {
+	Categories    []string        `json:"categories,omitempty"`
+	Address       string          `json:"address,omitempty"`
+	Email         string          `json:"email,omitempty"`
+	HoursTimeZone string          `json:"hoursTimeZone,omitempty"`
+	Hours         []BusinessHours `json:"hours,omitempty"`
+}
+
+type BusinessHours struct {
+	Day       string `json:"day"`
+	Mode      string `json:"mode"`
+	OpenTime  string `json:"openTime,omitempty"`
+	CloseTime string `json:"closeTime,omitempty"`
+}
+
+// cachedContactProfile returns a cached profile if it's still fresh
+func (client *WhatsAppClient) cachedContactProfile(jid types.JID) (ContactProfile, bool) {
+	client.contactMutex.Lock()
+	defer client.contactMutex.Unlock()
+
+	profile, exists := client.contactProfiles[jid.String()]
+	if !exists || time.Since(profile.FetchedAt) > contactProfileTTL {
+		return ContactProfile{}, false
+	}
+	return profile, true
+}
+
+// cacheContactProfile stores a profile under both its phone and LID JIDs
+func (client *WhatsAppClient) cacheContactProfile(profile ContactProfile, keys ...types.JID) {
+	client.contactMutex.Lock()
+	defer client.contactMutex.Unlock()
+
+	for _, key := range keys {
+		if !key.IsEmpty() {
+			client.contactProfiles[key.String()] = profile
+		}
+	}
+
+	// Drop expired entries so the cache doesn't grow without bound
+	for key, cached := range client.contactProfiles {
+		if time.Since(cached.FetchedAt) > contactProfileTTL {
+			delete(client.contactProfiles, key)
+		}
+	}
+}
+
+// fetchContactProfile looks up a contact's profile from WhatsApp. It returns nil if the user isn't on WhatsApp.
+func fetchContactProfile(client *WhatsAppClient, jid types.JID) (*ContactProfile, error) {
+	ctx := context.Background()
+	jid = jid.ToNonAD()
+
+	// Work out both halves of the LID <-> phone pair from the device store
+	var phoneJID, lidJID types.JID
+	if jid.Server == types.HiddenUserServer {
+		lidJID = jid
+		phoneJID, _ = client.deviceStore.LIDs.GetPNForLID(ctx, jid)
+	} else {
+		phoneJID = jid
+		lidJID, _ = client.deviceStore.LIDs.GetLIDForPN(ctx, jid)
+	}
+
+	infos, err := client.client.GetUserInfo(ctx, []types.JID{jid})
+	if err != nil {
+		return nil, err
+	}
+	info, exists := infos[jid]
+	if !exists {
+		return nil, nil
+	}
+	if lidJID.IsEmpty() && !info.LID.IsEmpty() {
+		lidJID = info.LID
+	}
+
+	profile := &ContactProfile{
+		JID:         jid.String(),
+		About:       info.Status,
+		PictureID:   info.PictureID,
+		DeviceCount: len(info.Devices),
+		FetchedAt:   time.Now(),
+	}
+	if !phoneJID.IsEmpty() {
+		profile.Phone = phoneJID.User
+	}
+	if !lidJID.IsEmpty() {
+		profile.LID = lidJID.String()
+	}
+
+	if info.VerifiedName != nil {
+		profile.IsBusiness = true
+		profile.VerifiedName = info.VerifiedName.Details.GetVerifiedName()
+
+		businessJID := jid
+		if !phoneJID.IsEmpty() {
+			businessJID = phoneJID
+		}
+		business, err := client.client.GetBusinessProfile(ctx, businessJID)
+		if err != nil {
+			// The profile is still useful without business details
+			LogClient.Warn("Failed to get business profile for %s: %v", businessJID.String(), err)
+		} else if business != nil {
+			profile.Business = newBusinessProfile(business)
+		}
+	}
+
+	return profile, nil
+}
+
+func newBusinessProfile(business *types.BusinessProfile) *BusinessProfile {
+	resp := &BusinessProfile{
+		Address:       business.Address,
+		Email:         business.Email,
+		HoursTimeZone: business.BusinessHoursTimeZone,
+	}
+	for _, category := range business.Categories {
+		resp.Categories = append(resp.Categories, category.Name)
+	}
+	for _, hours := range business.BusinessHours {
+		resp.Hours = append(resp.Hours, BusinessHours{
+			Day:       hours.DayOfWeek,
+			Mode:      hours.Mode,
+			OpenTime:  hours.OpenTime,
+			CloseTime: hours.CloseTime,
+		})
+	}
+	return resp
+}
+
+// @Summary Get contact profile
+// @Description Returns a contact's about text, verified business name and details, device count and LID/phone pair. Results are cached for 15 minutes.
+// @Tags contacts
+// @Produce json
+// @Param id path string true "Client ID"
+// @Param jid path string true "Phone number, phone JID or LID"
+// @Param refresh query bool false "Bypass the cache"
+// @Success 200 {object} ContactProfile
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /clients/{id}/contacts/{jid}/profile [get]
+func getContactProfile(c *gin.Context) {
+	clientID := c.Param("id")
+
+	waClient, err := manager.getClient(clientID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !waClient.isConnected {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "client is not connected"})
+		return
+	}
+
+	jid, err := parseChatJID(clientID, c.Param("jid"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if jid.Server != types.DefaultUserServer && jid.Server != types.HiddenUserServer {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "jid must be a user"})
+		return
+	}
+	jid = jid.ToNonAD()
+
+	refresh, _ := strconv.ParseBool(c.Query("refresh"))
+	if !refresh {
+		if profile, ok := waClient.cachedContactProfile(jid); ok {
+			profile.Cached = true
+			c.JSON(http.StatusOK, profile)
+			return
+		}
+	}
+
+	profile, err := fetchContactProfile(waClient, jid)
+	if err != nil {
+		LogClient.Error("Failed to get profile of %s for client %s: %v", jid.String(), clientID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if profile == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "user is not on WhatsApp"})
+		return
+	}
+
+	keys := []types.JID{jid}
+	if profile.Phone != "" {
+		keys = append(keys, types.NewJID(profile.Phone, types.DefaultUserServer))
+	}
+	if profile.LID != "" {
+		if lid, err := types.ParseJID(profile.LID); err == nil {
+			keys = append(keys, lid)
+		}
+	}
+	waClient.cacheContactProfile(*profile, keys...)
+
+	c.JSON(http.StatusOK, profile)
+}
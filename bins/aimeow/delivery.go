@@ -0,0 +1,226 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"time"
+
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	// deliveryRetention is how long delivered message IDs are remembered for deduplication
+	deliveryRetention     = 7 * 24 * time.Hour
+	deliveryPruneInterval = time.Hour
+
+	// defaultUndecryptableTimeout is how long to wait for a retried message before reporting it
+	defaultUndecryptableTimeout = 2 * time.Minute
+)
+
+// undecryptableTimeout can be raised with UNDECRYPTABLE_TIMEOUT for senders that are often offline
+var undecryptableTimeout = envDuration("UNDECRYPTABLE_TIMEOUT", defaultUndecryptableTimeout)
+
+const deliverySchema = `
+CREATE TABLE IF NOT EXISTS aimeow_webhook_deliveries (
+	client_id    TEXT    NOT NULL,
+	delivery_key TEXT    NOT NULL,
+	message_id   TEXT    NOT NULL,
+	event        TEXT    NOT NULL,
+	delivered_at INTEGER NOT NULL,
+	PRIMARY KEY (client_id, delivery_key)
+);
+CREATE INDEX IF NOT EXISTS aimeow_webhook_deliveries_message ON aimeow_webhook_deliveries (client_id, message_id, event)`
+
+// initDeliveryLog creates the table of delivered message webhooks
+func initDeliveryLog(ctx context.Context, db *sql.DB) error {
+	if _, err := db.ExecContext(ctx, deliverySchema); err != nil {
+		return fmt.Errorf("failed to create delivery table: %w", err)
+	}
+	return nil
+}
+
+// webhookIdempotencyKey derives a stable key, so a redelivered event gets the same key as the first delivery
+func webhookIdempotencyKey(clientID string, event string, parts ...string) string {
+	h := sha256.New()
+	h.Write([]byte(clientID + "\x00" + event))
+	for _, part := range parts {
+		h.Write([]byte("\x00" + part))
+	}
+	return hex.EncodeToString(h.Sum(nil))[:32]
+}
+
+// messageDeliveryKey identifies one logical message. Edits decoded from history reuse the original
+// message ID, so they are told apart by their timestamp.
+func messageDeliveryKey(msg *events.Message) string {
+	key := msg.Info.Chat.String() + "/" + msg.Info.ID
+	if msg.IsEdit {
+		key += "/edit/" + strconv.FormatInt(msg.Info.Timestamp.Unix(), 10)
+	}
+	return key
+}
+
+// isPlaceholderMessage reports whether a message carries nothing but encryption bookkeeping.
+// In groups the sender key arrives as its own part with the same ID as the real content.
+func isPlaceholderMessage(msg *waE2E.Message) bool {
+	if msg == nil {
+		return true
+	}
+	content := proto.Clone(msg).(*waE2E.Message)
+	content.SenderKeyDistributionMessage = nil
+	content.FastRatchetKeySenderKeyDistributionMessage = nil
+	content.MessageContextInfo = nil
+	return proto.Size(content) == 0
+}
+
+// claimDelivery records that a webhook is about to be sent. It returns false if it already was.
+func (cm *ClientManager) claimDelivery(ctx context.Context, clientID string, key string, messageID string, event string) (bool, error) {
+	result, err := cm.db.ExecContext(ctx, `
+		INSERT INTO aimeow_webhook_deliveries (client_id, delivery_key, message_id, event, delivered_at) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (client_id, delivery_key) DO NOTHING`,
+		clientID, key, messageID, event, time.Now().Unix())
+	if err != nil {
+		return false, fmt.Errorf("failed to record delivery: %w", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to record delivery: %w", err)
+	}
+	return n > 0, nil
+}
+
+// releaseDelivery forgets a claim whose webhook couldn't be sent, so a redelivery can go out
+func (cm *ClientManager) releaseDelivery(ctx context.Context, clientID string, key string) {
+	if _, err := cm.db.ExecContext(ctx, "DELETE FROM aimeow_webhook_deliveries WHERE client_id=? AND delivery_key=?", clientID, key); err != nil {
+		LogDatabase.Warn("Failed to release delivery %s for client %s: %v", key, clientID, err)
+	}
+}
+
+// hasDelivered reports whether a webhook of the given event was sent for a message
+func (cm *ClientManager) hasDelivered(ctx context.Context, clientID string, messageID string, event string) (bool, error) {
+	var delivered bool
+	err := cm.db.QueryRowContext(ctx, "SELECT COUNT(*) > 0 FROM aimeow_webhook_deliveries WHERE client_id=? AND message_id=? AND event=?",
+		clientID, messageID, event).Scan(&delivered)
+	if err != nil {
+		return false, fmt.Errorf("failed to look up delivery: %w", err)
+	}
+	return delivered, nil
+}
+
+// deleteClientDeliveries removes a client's delivery records
+func (cm *ClientManager) deleteClientDeliveries(ctx context.Context, clientID string) error {
+	if _, err := cm.db.ExecContext(ctx, "DELETE FROM aimeow_webhook_deliveries WHERE client_id=?", clientID); err != nil {
+		return fmt.Errorf("failed to delete deliveries: %w", err)
+	}
+	return nil
+}
+
+// runDeliveryPruner drops delivery records older than the deduplication window
+func (cm *ClientManager) runDeliveryPruner() {
+	ticker := time.NewTicker(deliveryPruneInterval)
+	defer ticker.Stop()
+
+	for {
+		cutoff := time.Now().Add(-deliveryRetention).Unix()
+		if result, err := cm.db.Exec("DELETE FROM aimeow_webhook_deliveries WHERE delivered_at < ?", cutoff); err != nil {
+			LogDatabase.Error("Failed to prune webhook deliveries: %v", err)
+		} else if n, _ := result.RowsAffected(); n > 0 {
+			LogDatabase.Info("Pruned %d webhook delivery records", n)
+		}
+		<-ticker.C
+	}
+}
+
+func undecryptableKey(info types.MessageInfo) string {
+	return info.Chat.String() + "/" + info.ID
+}
+
+// trackUndecryptable waits for whatsmeow's retry receipt to bring the message in. If it doesn't
+// arrive in time, a message.undecryptable status webhook is sent. Caller must hold client.mutex.
+func (cm *ClientManager) trackUndecryptable(client *WhatsAppClient, clientID string, evt *events.UndecryptableMessage) {
+	if clientID == "" || evt.DecryptFailMode == events.DecryptFailHide {
+		return
+	}
+
+	key := undecryptableKey(evt.Info)
+	if _, waiting := client.undecryptable[key]; waiting {
+		return
+	}
+	LogMessage.Warn("Could not decrypt message %s in %s (unavailable=%v), waiting %s for a retry",
+		evt.Info.ID, evt.Info.Chat.String(), evt.IsUnavailable, undecryptableTimeout)
+
+	var timer *time.Timer
+	timer = time.AfterFunc(undecryptableTimeout, func() {
+		client.mutex.Lock()
+		current := client.undecryptable[key]
+		if current == timer {
+			delete(client.undecryptable, key)
+		}
+		client.mutex.Unlock()
+
+		if current == timer {
+			client.events.submit(eventTask{lane: evt.Info.Chat.String(), run: func() {
+				cm.sendUndecryptableWebhook(client, clientID, evt)
+			}})
+		}
+	})
+	client.undecryptable[key] = timer
+}
+
+// resolveUndecryptable cancels the report of a message that was decrypted after all. Caller must hold client.mutex.
+func (client *WhatsAppClient) resolveUndecryptable(info types.MessageInfo) {
+	key := undecryptableKey(info)
+	if timer, waiting := client.undecryptable[key]; waiting {
+		timer.Stop()
+		delete(client.undecryptable, key)
+		LogMessage.Info("Message %s in %s decrypted after retry", info.ID, info.Chat.String())
+	}
+}
+
+// clearUndecryptable stops every pending report. Caller must hold client.mutex.
+func (client *WhatsAppClient) clearUndecryptable() {
+	for key, timer := range client.undecryptable {
+		timer.Stop()
+		delete(client.undecryptable, key)
+	}
+}
+
+func (cm *ClientManager) sendUndecryptableWebhook(client *WhatsAppClient, clientID string, evt *events.UndecryptableMessage) {
+	ctx := context.Background()
+
+	// Redelivered copies of a message that already went out can fail to decrypt; they aren't news
+	if delivered, err := cm.hasDelivered(ctx, clientID, evt.Info.ID, "message"); err != nil {
+		LogDatabase.Warn("%v", err)
+	} else if delivered {
+		LogMessage.Debug("Ignoring undecryptable copy of delivered message %s", evt.Info.ID)
+		return
+	}
+	if claimed, err := cm.claimDelivery(ctx, clientID, undecryptableKey(evt.Info)+"/undecryptable", evt.Info.ID, "message.undecryptable"); err != nil {
+		LogDatabase.Warn("%v", err)
+	} else if !claimed {
+		return
+	}
+
+	resolution := cm.resolveMessageSender(ctx, client, clientID, evt.Info)
+	data := MessageUndecryptableData{
+		MessageID:       evt.Info.ID,
+		Chat:            evt.Info.Chat.String(),
+		Sender:          evt.Info.Sender.String(),
+		Resolution:      resolution,
+		IsGroup:         evt.Info.IsGroup,
+		FromMe:          evt.Info.IsFromMe,
+		PushName:        evt.Info.PushName,
+		SentAt:          evt.Info.Timestamp.Unix(),
+		IsUnavailable:   evt.IsUnavailable,
+		UnavailableType: string(evt.UnavailableType),
+		DecryptFailMode: string(evt.DecryptFailMode),
+		WaitedSeconds:   int(undecryptableTimeout / time.Second),
+	}
+	cm.sendConnectionStatusWebhook(clientID, "message.undecryptable", data)
+}
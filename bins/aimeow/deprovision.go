@@ -0,0 +1,248 @@
+package main
+
+import (
+	"context"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DeprovisionOptions controls which optional data is purged when a client is deleted
+type DeprovisionOptions struct {
+	PurgeMedia    bool
+	PurgeMessages bool
+}
+
+// DeprovisionReport describes what was removed when a client was deleted
+type DeprovisionReport struct {
+	ClientID          string   `json:"clientId"`
+	Message           string   `json:"message"`
+	LoggedOut         bool     `json:"loggedOut"`
+	DeviceDeleted     bool     `json:"deviceDeleted"`
+	MappingRemoved    bool     `json:"mappingRemoved"`
+	PendingRemoved    bool     `json:"pendingRemoved"`
+	MediaPurged       bool     `json:"mediaPurged"`
+	MediaFilesRemoved int      `json:"mediaFilesRemoved"`
+	MessagesPurged    int      `json:"messagesPurged"`
+	Errors            []string `json:"errors,omitempty"`
+}
+
+// deprovisionClient logs out the linked device, deletes it from the device store and
+// removes every trace of the client from the manager's persistent state
+func (cm *ClientManager) deprovisionClient(clientID string, waClient *WhatsAppClient, opts DeprovisionOptions) DeprovisionReport {
+	report := DeprovisionReport{ClientID: clientID}
+	ctx := context.Background()
+
+	// Stop reacting to events and reconnecting while the client is being torn down
+	waClient.client.RemoveEventHandlers()
+	waClient.mutex.Lock()
+	waClient.manualDisconnect = true
+	waClient.cancelReconnect()
+	waClient.mutex.Unlock()
+	waClient.events.stop()
+
+	var whatsappID string
+	if waClient.deviceStore.ID != nil {
+		whatsappID = waClient.deviceStore.ID.String()
+	}
+
+	// Logout unlinks the companion device on the phone and deletes the device store
+	if whatsappID != "" && waClient.client.IsConnected() && waClient.client.IsLoggedIn() {
+		if err := waClient.client.Logout(ctx); err != nil {
+			LogClient.Warn("Failed to log out client %s, removing local session only: %v", clientID, err)
+			report.Errors = append(report.Errors, "logout: "+err.Error())
+		} else {
+			report.LoggedOut = true
+			report.DeviceDeleted = true
+		}
+	}
+
+	waClient.client.Disconnect()
+
+	if !report.DeviceDeleted && waClient.deviceStore.ID != nil {
+		if err := waClient.deviceStore.Delete(ctx); err != nil {
+			LogDatabase.Error("Failed to delete device store for client %s: %v", clientID, err)
+			report.Errors = append(report.Errors, "device store: "+err.Error())
+		} else {
+			report.DeviceDeleted = true
+		}
+	}
+
+	// Stop any typing indicator and chat pause timers still pending for this client
+	waClient.clearPausedChats()
+	waClient.mutex.Lock()
+	for chatID, timer := range waClient.typingTimers {
+		if timer != nil {
+			timer.Stop()
+		}
+		delete(waClient.typingTimers, chatID)
+	}
+	waClient.clearUndecryptable()
+	if opts.PurgeMessages {
+		report.MessagesPurged = len(waClient.messages)
+		waClient.messages = make([]string, 0)
+		waClient.originals = make(map[string]storedMessage)
+		waClient.originalOrder = nil
+	}
+	waClient.mutex.Unlock()
+
+	// Remove from manager and persistent mappings
+	cm.mutex.Lock()
+	delete(cm.clients, clientID)
+	for waID, uuid := range cm.clientIDMap {
+		if uuid == clientID || waID == whatsappID {
+			delete(cm.clientIDMap, waID)
+			report.MappingRemoved = true
+		}
+	}
+	if _, exists := cm.pendingClients[clientID]; exists {
+		delete(cm.pendingClients, clientID)
+		report.PendingRemoved = true
+	}
+	_, hasSettings := cm.clientSettings[clientID]
+	delete(cm.clientSettings, clientID)
+	cm.mutex.Unlock()
+
+	if report.MappingRemoved {
+		if err := cm.saveClientMappings(); err != nil {
+			LogClient.Warn("Failed to save client mappings: %v", err)
+			report.Errors = append(report.Errors, "client mappings: "+err.Error())
+		}
+	}
+	if report.PendingRemoved {
+		if err := cm.savePendingClients(); err != nil {
+			LogClient.Warn("Failed to save pending clients: %v", err)
+			report.Errors = append(report.Errors, "pending clients: "+err.Error())
+		}
+	}
+
+	if hasSettings {
+		if err := cm.saveClientSettings(); err != nil {
+			LogConfig.Warn("Failed to save client settings: %v", err)
+			report.Errors = append(report.Errors, "client settings: "+err.Error())
+		}
+	}
+
+	// Avatars are only a cache, so they always go
+	if err := purgeClientAvatars(clientID); err != nil {
+		LogMedia.Warn("Failed to remove avatar cache for client %s: %v", clientID, err)
+		report.Errors = append(report.Errors, "avatars: "+err.Error())
+	}
+
+	// Same for the LID ↔ phone cache, the record of delivered webhooks and the event log
+	if err := cm.deleteClientLIDMappings(ctx, clientID); err != nil {
+		LogDatabase.Warn("Failed to delete LID mappings for client %s: %v", clientID, err)
+		report.Errors = append(report.Errors, "LID mappings: "+err.Error())
+	}
+	if err := cm.deleteClientDeliveries(ctx, clientID); err != nil {
+		LogDatabase.Warn("Failed to delete webhook deliveries for client %s: %v", clientID, err)
+		report.Errors = append(report.Errors, "webhook deliveries: "+err.Error())
+	}
+	if err := cm.deleteClientEventLog(ctx, clientID); err != nil {
+		LogDatabase.Warn("Failed to delete event log for client %s: %v", clientID, err)
+		report.Errors = append(report.Errors, "event log: "+err.Error())
+	}
+
+	if opts.PurgeMedia {
+		// Files on remote backends are deleted one by one, local ones with their directory
+		var remote PurgeMediaReport
+		if records, err := cm.queryMedia(ctx, clientID, "backend<>?", StorageLocal); err != nil {
+			report.Errors = append(report.Errors, "media: "+err.Error())
+		} else {
+			cm.deleteMediaRecords(ctx, records, &remote)
+			report.Errors = append(report.Errors, remote.Errors...)
+		}
+
+		removed, err := purgeClientMedia(clientID)
+		report.MediaFilesRemoved = removed + remote.FilesRemoved
+		if err != nil {
+			LogMedia.Error("Failed to purge media for client %s: %v", clientID, err)
+			report.Errors = append(report.Errors, "media: "+err.Error())
+		} else {
+			report.MediaPurged = true
+		}
+		if err := cm.deleteClientMediaRecords(ctx, clientID); err != nil {
+			LogDatabase.Error("Failed to delete media records for client %s: %v", clientID, err)
+			report.Errors = append(report.Errors, "media records: "+err.Error())
+		}
+	}
+
+	LogClient.Info("Deprovisioned client %s (loggedOut=%v, deviceDeleted=%v, mediaFiles=%d, messages=%d)",
+		clientID, report.LoggedOut, report.DeviceDeleted, report.MediaFilesRemoved, report.MessagesPurged)
+
+	report.Message = "client deleted successfully"
+	return report
+}
+
+// purgeClientMedia removes the client's media directory and returns how many files it held
+func purgeClientMedia(clientID string) (int, error) {
+	clientDir := filepath.Join(dataDir, "files", clientID)
+
+	count := 0
+	err := filepath.WalkDir(clientDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			count++
+		}
+		return nil
+	})
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, err
+	}
+
+	if err := os.RemoveAll(clientDir); err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+// parseDeprovisionOptions reads the purge flags from the query string
+func parseDeprovisionOptions(c *gin.Context) DeprovisionOptions {
+	var opts DeprovisionOptions
+	if v, err := strconv.ParseBool(c.Query("purgeMedia")); err == nil {
+		opts.PurgeMedia = v
+	}
+	if v, err := strconv.ParseBool(c.Query("purgeMessages")); err == nil {
+		opts.PurgeMessages = v
+	}
+	if v, err := strconv.ParseBool(c.Query("purge")); err == nil && v {
+		opts.PurgeMedia = true
+		opts.PurgeMessages = true
+	}
+	return opts
+}
+
+// @Summary Deprovision and delete client
+// @Description Logs out the linked device, deletes its session and mappings, and optionally purges media and messages
+// @Tags clients
+// @Accept json
+// @Produce json
+// @Param id path string true "Client ID"
+// @Param purgeMedia query bool false "Delete downloaded media files"
+// @Param purgeMessages query bool false "Delete stored messages"
+// @Param purge query bool false "Shorthand for purgeMedia and purgeMessages"
+// @Success 200 {object} DeprovisionReport
+// @Failure 404 {object} map[string]string
+// @Router /clients/{id} [delete]
+func deleteClient(c *gin.Context) {
+	clientID := c.Param("id")
+
+	waClient, err := manager.getClient(clientID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	report := manager.deprovisionClient(clientID, waClient, parseDeprovisionOptions(c))
+
+	c.JSON(http.StatusOK, report)
+}
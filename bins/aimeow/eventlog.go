@@ -0,0 +1,289 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// defaultEventLogRetention is how long logged events can be replayed
+	defaultEventLogRetention = 72 * time.Hour
+	eventLogPruneInterval    = time.Hour
+
+	defaultEventLogLimit = 100
+)
+
+// eventLogRetention can be changed with EVENT_LOG_RETENTION
+var eventLogRetention = envDuration("EVENT_LOG_RETENTION", defaultEventLogRetention)
+
+const eventLogSchema = `
+CREATE TABLE IF NOT EXISTS aimeow_event_log (
+	seq             INTEGER PRIMARY KEY AUTOINCREMENT,
+	client_id       TEXT    NOT NULL,
+	event           TEXT    NOT NULL,
+	category        TEXT    NOT NULL,
+	idempotency_key TEXT    NOT NULL UNIQUE,
+	payload         TEXT    NOT NULL,
+	created_at      INTEGER NOT NULL
+);
+CREATE INDEX IF NOT EXISTS aimeow_event_log_created ON aimeow_event_log (created_at)`
+
+// LoggedEvent is a webhook as it was recorded in the event log. Payload is the body in the current schema version.
+type LoggedEvent struct {
+	Seq            int64           `json:"seq"`
+	ClientID       string          `json:"clientId"`
+	Event          string          `json:"event"`
+	Category       string          `json:"category"`
+	IdempotencyKey string          `json:"idempotencyKey"`
+	CreatedAt      int64           `json:"createdAt"`
+	Payload        json.RawMessage `json:"payload" swaggertype:"object"`
+}
+
+type EventLogResponse struct {
+	Events     []LoggedEvent `json:"events"`
+	NextCursor int64         `json:"nextCursor"` // pass as after to continue
+	HasMore    bool          `json:"hasMore"`
+	Truncated  bool          `json:"truncated"` // events after the cursor were already pruned
+}
+
+// initEventLog creates the event log table
+func initEventLog(ctx context.Context, db *sql.DB) error {
+	if _, err := db.ExecContext(ctx, eventLogSchema); err != nil {
+		return fmt.Errorf("failed to create event log table: %w", err)
+	}
+	return nil
+}
+
+// eventLogSignal wakes long polls up when an event is logged
+type eventLogSignal struct {
+	mutex sync.Mutex
+	ch    chan struct{}
+}
+
+var eventLogAppended = &eventLogSignal{ch: make(chan struct{})}
+
+// wait returns a channel that is closed by the next notify
+func (s *eventLogSignal) wait() <-chan struct{} {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.ch
+}
+
+func (s *eventLogSignal) notify() {
+	s.mutex.Lock()
+	close(s.ch)
+	s.ch = make(chan struct{})
+	s.mutex.Unlock()
+}
+
+// appendEventLog records a webhook before it is sent, so consumers can replay it even if no push gets through.
+// An event whose idempotency key is already logged, like a redelivered message, is not logged twice.
+func (cm *ClientManager) appendEventLog(clientID string, event string, idempotencyKey string, payload interface{}) {
+	if clientID == "" {
+		return
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		LogWebhook.Error("Failed to marshal %s for the event log: %v", event, err)
+		return
+	}
+	category := CategoryStatus
+	if spec, ok := findWebhookEvent(event); ok {
+		category = spec.Category
+	}
+
+	// A conflicting INSERT would still use up a sequence number, and gaps would look like pruned events
+	result, err := cm.db.Exec(`
+		INSERT INTO aimeow_event_log (client_id, event, category, idempotency_key, payload, created_at)
+		SELECT ?, ?, ?, ?, ?, ? WHERE NOT EXISTS (SELECT 1 FROM aimeow_event_log WHERE idempotency_key = ?)`,
+		clientID, event, category, idempotencyKey, string(body), time.Now().Unix(), idempotencyKey)
+	if err != nil {
+		LogDatabase.Error("Failed to log %s event for client %s: %v", event, clientID, err)
+		return
+	}
+	if n, _ := result.RowsAffected(); n > 0 {
+		eventLogAppended.notify()
+	}
+}
+
+// EventLogQuery selects events from the log
+type EventLogQuery struct {
+	After    int64  `form:"after" binding:"min=0"`
+	Limit    int    `form:"limit" binding:"omitempty,min=1,max=1000"`
+	Wait     int    `form:"wait" binding:"omitempty,min=0,max=60"` // seconds to wait for new events when there are none
+	ClientID string `form:"clientId"`
+	Events   string `form:"events"` // comma-separated categories
+}
+
+// readEventLog returns up to limit+1 events after a cursor, so the caller can tell whether there are more
+func (cm *ClientManager) readEventLog(ctx context.Context, query EventLogQuery, categories []string) ([]LoggedEvent, error) {
+	sqlQuery := "SELECT seq, client_id, event, category, idempotency_key, payload, created_at FROM aimeow_event_log WHERE seq > ?"
+	args := []interface{}{query.After}
+	if query.ClientID != "" {
+		sqlQuery += " AND client_id = ?"
+		args = append(args, query.ClientID)
+	}
+	if len(categories) > 0 {
+		sqlQuery += " AND category IN (?" + strings.Repeat(", ?", len(categories)-1) + ")"
+		for _, category := range categories {
+			args = append(args, category)
+		}
+	}
+	sqlQuery += " ORDER BY seq LIMIT ?"
+	args = append(args, query.Limit+1)
+
+	rows, err := cm.db.QueryContext(ctx, sqlQuery, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read event log: %w", err)
+	}
+	defer rows.Close()
+
+	events := make([]LoggedEvent, 0)
+	for rows.Next() {
+		var event LoggedEvent
+		var payload string
+		if err := rows.Scan(&event.Seq, &event.ClientID, &event.Event, &event.Category, &event.IdempotencyKey, &payload, &event.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to read event log: %w", err)
+		}
+		event.Payload = json.RawMessage(payload)
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
+
+// eventLogTruncated reports whether events right after the cursor have been pruned.
+// Reading from the start (after=0) means from the oldest event kept, which is never truncated.
+func (cm *ClientManager) eventLogTruncated(ctx context.Context, after int64) (bool, error) {
+	if after == 0 {
+		return false, nil
+	}
+
+	var oldest sql.NullInt64
+	if err := cm.db.QueryRowContext(ctx, "SELECT MIN(seq) FROM aimeow_event_log").Scan(&oldest); err != nil {
+		return false, fmt.Errorf("failed to read event log: %w", err)
+	}
+	if oldest.Valid {
+		return after+1 < oldest.Int64, nil
+	}
+
+	// Everything was pruned; anything logged since the cursor is gone
+	var last sql.NullInt64
+	if err := cm.db.QueryRowContext(ctx, "SELECT seq FROM sqlite_sequence WHERE name='aimeow_event_log'").Scan(&last); err != nil && err != sql.ErrNoRows {
+		return false, fmt.Errorf("failed to read event log: %w", err)
+	}
+	return last.Valid && after < last.Int64, nil
+}
+
+// deleteClientEventLog removes a client's logged events
+func (cm *ClientManager) deleteClientEventLog(ctx context.Context, clientID string) error {
+	if _, err := cm.db.ExecContext(ctx, "DELETE FROM aimeow_event_log WHERE client_id=?", clientID); err != nil {
+		return fmt.Errorf("failed to delete event log: %w", err)
+	}
+	return nil
+}
+
+// runEventLogPruner drops events older than the retention window
+func (cm *ClientManager) runEventLogPruner() {
+	ticker := time.NewTicker(eventLogPruneInterval)
+	defer ticker.Stop()
+
+	for {
+		cutoff := time.Now().Add(-eventLogRetention).Unix()
+		if result, err := cm.db.Exec("DELETE FROM aimeow_event_log WHERE created_at < ?", cutoff); err != nil {
+			LogDatabase.Error("Failed to prune event log: %v", err)
+		} else if n, _ := result.RowsAffected(); n > 0 {
+			LogDatabase.Info("Pruned %d events from the event log", n)
+		}
+		<-ticker.C
+	}
+}
+
+// @Summary Replay events
+// @Description Returns logged webhook events after a cursor, oldest first. With wait, the request is held until an event arrives or the wait runs out.
+// @Tags events
+// @Produce json
+// @Param after query int false "Sequence number of the last event already processed (nextCursor of the previous page)"
+// @Param limit query int false "Maximum number of events (default 100, max 1000)"
+// @Param wait query int false "Seconds to wait for new events when there are none (max 60)"
+// @Param clientId query string false "Only events of this client"
+// @Param events query string false "Comma-separated categories: messages, status, receipts, groups, calls"
+// @Success 200 {object} EventLogResponse
+// @Failure 400 {object} map[string]string
+// @Router /events/log [get]
+func getEventLog(c *gin.Context) {
+	var query EventLogQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if query.Limit == 0 {
+		query.Limit = defaultEventLogLimit
+	}
+
+	var categories []string
+	for _, category := range strings.Split(query.Events, ",") {
+		if category = strings.TrimSpace(category); category == "" {
+			continue
+		}
+		switch category {
+		case CategoryMessages, CategoryStatus, CategoryReceipts, CategoryGroups, CategoryCalls:
+			categories = append(categories, category)
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{"error": "unknown event category: " + category})
+			return
+		}
+	}
+
+	ctx := c.Request.Context()
+	deadline := time.Now().Add(time.Duration(query.Wait) * time.Second)
+	var events []LoggedEvent
+	for {
+		// Take the signal before reading, so an event logged in between isn't missed
+		appended := eventLogAppended.wait()
+
+		var err error
+		if events, err = manager.readEventLog(ctx, query, categories); err != nil {
+			LogDatabase.Error("%v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		remaining := time.Until(deadline)
+		if len(events) > 0 || remaining <= 0 {
+			break
+		}
+
+		timer := time.NewTimer(remaining)
+		select {
+		case <-appended:
+			timer.Stop()
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		}
+	}
+
+	truncated, err := manager.eventLogTruncated(ctx, query.After)
+	if err != nil {
+		LogDatabase.Warn("%v", err)
+	}
+
+	response := EventLogResponse{Events: events, NextCursor: query.After, Truncated: truncated}
+	if len(events) > query.Limit {
+		response.Events = events[:query.Limit]
+		response.HasMore = true
+	}
+	if n := len(response.Events); n > 0 {
+		response.NextCursor = response.Events[n-1].Seq
+	}
+	c.JSON(http.StatusOK, response)
+}
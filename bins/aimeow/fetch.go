@@ -0,0 +1,255 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	defaultFetchTimeout        = 60 * time.Second
+	defaultFetchConnectTimeout = 10 * time.Second
+	defaultFetchMaxBytes       = 100 << 20 // WhatsApp's own document limit
+	defaultFetchConcurrency    = 4         // downloads held in memory at once
+	maxFetchRedirects          = 5
+)
+
+var errFetchBlocked = errors.New("URL is not allowed")
+
+// carrierGradeNAT (100.64.0.0/10) isn't covered by net.IP.IsPrivate but is just as internal
+var carrierGradeNAT = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+// reservedNetworks are other IPv4 special-purpose ranges that net.IP's predicates miss
+var reservedNetworks = []*net.IPNet{
+	{IP: net.IPv4(0, 0, 0, 0), Mask: net.CIDRMask(8, 32)},     // "this network"; Linux routes 0.x.x.x to the local host
+	{IP: net.IPv4(192, 0, 0, 0), Mask: net.CIDRMask(24, 32)},  // IETF protocol assignments
+	{IP: net.IPv4(198, 18, 0, 0), Mask: net.CIDRMask(15, 32)}, // benchmarking
+	{IP: net.IPv4(240, 0, 0, 0), Mask: net.CIDRMask(4, 32)},   // reserved, including broadcast
+}
+
+// IPv6 ranges that carry an IPv4 address, which is what the connection ends up reaching
+var (
+	nat64Prefix = &net.IPNet{IP: net.ParseIP("64:ff9b::"), Mask: net.CIDRMask(96, 128)} // address in the last 4 bytes
+	sixToFour   = &net.IPNet{IP: net.ParseIP("2002::"), Mask: net.CIDRMask(16, 128)}    // address in bytes 2-5
+)
+
+// urlFetcher downloads caller-supplied URLs with timeouts, a size cap and address checks
+type urlFetcher struct {
+	client       *http.Client
+	maxBytes     int64
+	allowHosts   []string // when set, only these hosts (and their subdomains) may be fetched
+	denyHosts    []string
+	allowPrivate bool          // permit private, loopback and link-local addresses
+	slots        chan struct{} // bounds concurrent downloads, as each is buffered in memory
+}
+
+// FetchedFile is a downloaded body with the metadata callers need
+type FetchedFile struct {
+	Data        []byte
+	ContentType string
+	URL         *url.URL // final URL after redirects
+}
+
+// mediaFetcher is shared by every endpoint that downloads from a URL in the request
+var mediaFetcher = newURLFetcher()
+
+// newURLFetcher configures a fetcher from FETCH_* environment variables
+func newURLFetcher() *urlFetcher {
+	f := &urlFetcher{
+		maxBytes:     defaultFetchMaxBytes,
+		allowHosts:   splitHostList(os.Getenv("FETCH_ALLOW_HOSTS")),
+		denyHosts:    splitHostList(os.Getenv("FETCH_DENY_HOSTS")),
+		allowPrivate: os.Getenv("FETCH_ALLOW_PRIVATE") == "true",
+	}
+	if n, err := strconv.ParseInt(os.Getenv("FETCH_MAX_BYTES"), 10, 64); err == nil && n > 0 {
+		f.maxBytes = n
+	}
+	concurrency := defaultFetchConcurrency
+	if n, err := strconv.Atoi(os.Getenv("FETCH_CONCURRENCY")); err == nil && n > 0 {
+		concurrency = n
+	}
+	f.slots = make(chan struct{}, concurrency)
+
+	timeout := envDuration("FETCH_TIMEOUT", defaultFetchTimeout)
+	connectTimeout := envDuration("FETCH_CONNECT_TIMEOUT", defaultFetchConnectTimeout)
+
+	dialer := &net.Dialer{
+		Timeout: connectTimeout,
+		// Checked on the resolved address right before connecting, so DNS tricks and redirects can't get around it
+		Control: f.checkDialAddress,
+	}
+	f.client = &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			Proxy:                 nil, // a proxy would be dialed instead of the target, skipping the address check
+			DialContext:           dialer.DialContext,
+			TLSHandshakeTimeout:   connectTimeout,
+			ResponseHeaderTimeout: timeout,
+			MaxIdleConns:          10,
+			IdleConnTimeout:       90 * time.Second,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= maxFetchRedirects {
+				return fmt.Errorf("stopped after %d redirects", maxFetchRedirects)
+			}
+			return f.checkURL(req.URL)
+		},
+	}
+	return f
+}
+
+func envDuration(name string, fallback time.Duration) time.Duration {
+	if d, err := time.ParseDuration(os.Getenv(name)); err == nil && d > 0 {
+		return d
+	}
+	return fallback
+}
+
+func splitHostList(s string) []string {
+	var hosts []string
+	for _, host := range strings.Split(s, ",") {
+		if host = strings.ToLower(strings.TrimSpace(host)); host != "" {
+			hosts = append(hosts, strings.TrimPrefix(host, "*."))
+		}
+	}
+	return hosts
+}
+
+// hostMatches reports whether host is one of the entries or a subdomain of one
+func hostMatches(host string, entries []string) bool {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	for _, entry := range entries {
+		if host == entry || strings.HasSuffix(host, "."+entry) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkURL applies the scheme and host rules to a URL, including every redirect target
+func (f *urlFetcher) checkURL(u *url.URL) error {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("%w: scheme %q", errFetchBlocked, u.Scheme)
+	}
+	host := u.Hostname()
+	if host == "" {
+		return fmt.Errorf("%w: missing host", errFetchBlocked)
+	}
+	if hostMatches(host, f.denyHosts) {
+		return fmt.Errorf("%w: host %s is denied", errFetchBlocked, host)
+	}
+	if len(f.allowHosts) > 0 && !hostMatches(host, f.allowHosts) {
+		return fmt.Errorf("%w: host %s is not in the allow list", errFetchBlocked, host)
+	}
+	return nil
+}
+
+// checkDialAddress refuses connections to internal addresses unless FETCH_ALLOW_PRIVATE is set
+func (f *urlFetcher) checkDialAddress(network, address string, _ syscall.RawConn) error {
+	if f.allowPrivate {
+		return nil
+	}
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return fmt.Errorf("%w: unresolved address %s", errFetchBlocked, host)
+	}
+	if isInternalIP(ip) {
+		return fmt.Errorf("%w: %s is a private address", errFetchBlocked, ip)
+	}
+	return nil
+}
+
+func isInternalIP(ip net.IP) bool {
+	if ip4 := embeddedIPv4(ip); ip4 != nil {
+		ip = ip4
+	}
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified() || carrierGradeNAT.Contains(ip) {
+		return true
+	}
+	for _, network := range reservedNetworks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// embeddedIPv4 returns the IPv4 address an IPv4, IPv4-mapped, NAT64 or 6to4 address leads to
+func embeddedIPv4(ip net.IP) net.IP {
+	if ip4 := ip.To4(); ip4 != nil {
+		return ip4
+	}
+	ip16 := ip.To16()
+	switch {
+	case ip16 == nil:
+		return nil
+	case nat64Prefix.Contains(ip16):
+		return net.IPv4(ip16[12], ip16[13], ip16[14], ip16[15]).To4()
+	case sixToFour.Contains(ip16):
+		return net.IPv4(ip16[2], ip16[3], ip16[4], ip16[5]).To4()
+	}
+	return nil
+}
+
+// fetch downloads a URL into memory, up to the size cap
+func (f *urlFetcher) fetch(ctx context.Context, rawURL string) (*FetchedFile, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid URL: %w", err)
+	}
+	if err := f.checkURL(u); err != nil {
+		return nil, err
+	}
+
+	select {
+	case f.slots <- struct{}{}:
+		defer func() { <-f.slots }()
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("download failed with status: %d", resp.StatusCode)
+	}
+	if resp.ContentLength > f.maxBytes {
+		return nil, fmt.Errorf("file is %d bytes, larger than the limit of %d", resp.ContentLength, f.maxBytes)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, f.maxBytes+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+	if int64(len(data)) > f.maxBytes {
+		return nil, fmt.Errorf("file is larger than the limit of %d bytes", f.maxBytes)
+	}
+
+	return &FetchedFile{
+		Data:        data,
+		ContentType: resp.Header.Get("Content-Type"),
+		URL:         resp.Request.URL,
+	}, nil
+}
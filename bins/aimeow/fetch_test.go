@@ -0,0 +1,86 @@
+package main
+
+import (
+	"net"
+	"testing"
+)
+
+func TestIsInternalIP(t *testing.T) {
+	tests := []struct {
+		ip       string
+		internal bool
+	}{
+		// Public
+		{"8.8.8.8", false},
+		{"1.1.1.1", false},
+		{"100.63.255.255", false},
+		{"198.20.0.1", false},
+		{"2606:4700:4700::1111", false},
+		{"64:ff9b::808:808", false}, // NAT64 of 8.8.8.8
+		{"2002:808:808::1", false},  // 6to4 of 8.8.8.8
+		{"::ffff:8.8.8.8", false},   // IPv4-mapped
+
+		// Loopback, private, link-local
+		{"127.0.0.1", true},
+		{"10.1.2.3", true},
+		{"172.16.0.1", true},
+		{"192.168.1.1", true},
+		{"169.254.169.254", true},
+		{"::1", true},
+		{"fc00::1", true},
+		{"fe80::1", true},
+
+		// Special-purpose IPv4 ranges
+		{"0.0.0.0", true},
+		{"0.1.2.3", true},
+		{"100.64.0.1", true},
+		{"100.127.255.255", true},
+		{"192.0.0.8", true},
+		{"198.18.0.1", true},
+		{"198.19.255.255", true},
+		{"224.0.0.1", true},
+		{"240.0.0.1", true},
+		{"255.255.255.255", true},
+		{"::", true},
+
+		// IPv4 embedded in IPv6
+		{"::ffff:127.0.0.1", true},
+		{"::ffff:10.0.0.1", true},
+		{"64:ff9b::7f00:1", true},    // NAT64 of 127.0.0.1
+		{"64:ff9b::a9fe:a9fe", true}, // NAT64 of 169.254.169.254
+		{"64:ff9b::c0a8:101", true},  // NAT64 of 192.168.1.1
+		{"2002:7f00:1::1", true},     // 6to4 of 127.0.0.1
+		{"2002:a00:1::", true},       // 6to4 of 10.0.0.1
+		{"2002:c612:1::1", true},     // 6to4 of 198.18.0.1
+	}
+	for _, tt := range tests {
+		ip := net.ParseIP(tt.ip)
+		if ip == nil {
+			t.Fatalf("invalid test address %q", tt.ip)
+		}
+		if got := isInternalIP(ip); got != tt.internal {
+			t.Errorf("isInternalIP(%s) = %v, want %v", tt.ip, got, tt.internal)
+		}
+	}
+}
+
+func TestHostMatches(t *testing.T) {
+	entries := []string{"example.com", "cdn.example.org"}
+	tests := []struct {
+		host  string
+		match bool
+	}{
+		{"example.com", true},
+		{"EXAMPLE.com.", true},
+		{"img.example.com", true},
+		{"notexample.com", false},
+		{"example.com.evil.net", false},
+		{"cdn.example.org", true},
+		{"example.org", false},
+	}
+	for _, tt := range tests {
+		if got := hostMatches(tt.host, entries); got != tt.match {
+			t.Errorf("hostMatches(%q) = %v, want %v", tt.host, got, tt.match)
+		}
+	}
+}
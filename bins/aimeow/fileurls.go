@@ -0,0 +1,146 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// defaultFileURLTTL is how long /files links stay valid unless FILE_URL_TTL says otherwise
+const defaultFileURLTTL = 7 * 24 * time.Hour
+
+var (
+	fileURLSecret []byte
+	fileURLTTL    = defaultFileURLTTL
+)
+
+type SignedFileURLResponse struct {
+	URL       string    `json:"url"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// initFileURLSigning loads the key /files links are signed with. FILE_URL_SECRET wins; otherwise a
+// random key is generated once and kept in the data directory so links survive restarts.
+func initFileURLSigning() error {
+	if ttl := os.Getenv("FILE_URL_TTL"); ttl != "" {
+		parsed, err := time.ParseDuration(ttl)
+		if err != nil || parsed <= 0 {
+			return fmt.Errorf("invalid FILE_URL_TTL %q", ttl)
+		}
+		fileURLTTL = parsed
+	}
+
+	if secret := os.Getenv("FILE_URL_SECRET"); secret != "" {
+		fileURLSecret = []byte(secret)
+		return nil
+	}
+
+	secretPath := filepath.Join(dataDir, "file_url_secret")
+	if data, err := os.ReadFile(secretPath); err == nil && len(strings.TrimSpace(string(data))) > 0 {
+		fileURLSecret = []byte(strings.TrimSpace(string(data)))
+		return nil
+	}
+
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return fmt.Errorf("failed to generate file URL secret: %w", err)
+	}
+	fileURLSecret = []byte(hex.EncodeToString(key))
+	if err := os.WriteFile(secretPath, fileURLSecret, 0600); err != nil {
+		return fmt.Errorf("failed to save file URL secret: %w", err)
+	}
+	LogConfig.Info("Generated file URL signing key at %s", secretPath)
+	return nil
+}
+
+func fileURLSignature(clientID, fileID string, expires int64) string {
+	mac := hmac.New(sha256.New, fileURLSecret)
+	fmt.Fprintf(mac, "%s/%s/%d", clientID, fileID, expires)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// signedFileURL returns a /files link that stops working after ttl
+func signedFileURL(clientID, fileID string, ttl time.Duration) (string, time.Time) {
+	expiresAt := time.Now().Add(ttl).Truncate(time.Second)
+	query := url.Values{}
+	query.Set("expires", strconv.FormatInt(expiresAt.Unix(), 10))
+	query.Set("sig", fileURLSignature(clientID, fileID, expiresAt.Unix()))
+	return fmt.Sprintf("%s/files/%s/%s?%s", baseURL, clientID, fileID, query.Encode()), expiresAt
+}
+
+// verifyFileURL checks the signature and expiry of a /files request
+func verifyFileURL(c *gin.Context, clientID, fileID string) (int, string) {
+	expires, err := strconv.ParseInt(c.Query("expires"), 10, 64)
+	sig := c.Query("sig")
+	if err != nil || sig == "" {
+		return http.StatusForbidden, "missing or malformed signature"
+	}
+	if !hmac.Equal([]byte(sig), []byte(fileURLSignature(clientID, fileID, expires))) {
+		return http.StatusForbidden, "invalid signature"
+	}
+	if time.Now().Unix() > expires {
+		return http.StatusGone, "link expired"
+	}
+	return http.StatusOK, ""
+}
+
+// @Summary Mint signed file URL
+// @Description Returns a fresh signed, expiring /files link for a stored media item
+// @Tags files
+// @Produce json
+// @Param id path string true "Client ID"
+// @Param file_id path string true "File (message) ID"
+// @Param ttl query string false "Validity as a duration, e.g. 1h (defaults to and may not exceed FILE_URL_TTL)"
+// @Success 200 {object} SignedFileURLResponse
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /clients/{id}/files/{file_id}/url [post]
+func mintFileURL(c *gin.Context) {
+	clientID := c.Param("id")
+	fileID := c.Param("file_id")
+
+	if _, err := manager.getClient(clientID); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	ttl := fileURLTTL
+	if raw := c.Query("ttl"); raw != "" {
+		parsed, err := time.ParseDuration(raw)
+		if err != nil || parsed <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "ttl must be a positive duration such as 30m or 24h"})
+			return
+		}
+		// FILE_URL_TTL is the longest a link may live, so a leaked API key can't mint links that never expire
+		if parsed > fileURLTTL {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("ttl may not exceed %s", fileURLTTL)})
+			return
+		}
+		ttl = parsed
+	}
+
+	record, err := manager.getMedia(c.Request.Context(), clientID, fileID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if record == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "file not found"})
+		return
+	}
+
+	fileURL, expiresAt := signedFileURL(clientID, fileID, ttl)
+	c.JSON(http.StatusOK, SignedFileURLResponse{URL: fileURL, ExpiresAt: expiresAt})
+}
@@ -0,0 +1,286 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	// maxStoredOriginals is how many received messages per client are kept for forwarding
+	maxStoredOriginals = 1000
+
+	// mediaReuseMaxAge is how long uploaded media can be referenced again before it's
+	// safer to download and upload it anew
+	mediaReuseMaxAge = 7 * 24 * time.Hour
+)
+
+// storedMessage is the original protobuf of a received message
+type storedMessage struct {
+	Info    types.MessageInfo
+	Message *waE2E.Message
+}
+
+type ForwardMessageRequest struct {
+	Chat         string   `json:"chat" binding:"required"`      // Chat the original message is in
+	MessageID    string   `json:"messageId" binding:"required"` // ID of the message to forward
+	Destinations []string `json:"destinations" binding:"required,min=1,max=50,dive,required"`
+	Reupload     bool     `json:"reupload,omitempty"` // Always upload media again instead of reusing the original keys
+}
+
+type ForwardResult struct {
+	To          string `json:"to"`
+	Success     bool   `json:"success"`
+	MessageID   string `json:"messageId,omitempty"`
+	MediaReused bool   `json:"mediaReused,omitempty"`
+	Error       string `json:"error,omitempty"`
+}
+
+type ForwardMessageResponse struct {
+	Success bool            `json:"success"`
+	Results []ForwardResult `json:"results"`
+}
+
+func storedMessageKey(chat types.JID, messageID string) string {
+	return chat.ToNonAD().String() + "/" + messageID
+}
+
+// storeOriginal keeps a received message so it can be forwarded later. Caller must hold client.mutex.
+func (client *WhatsAppClient) storeOriginal(msg *events.Message) {
+	key := storedMessageKey(msg.Info.Chat, msg.Info.ID)
+	if _, exists := client.originals[key]; !exists {
+		client.originalOrder = append(client.originalOrder, key)
+	}
+	client.originals[key] = storedMessage{Info: msg.Info, Message: msg.Message}
+
+	for len(client.originalOrder) > maxStoredOriginals {
+		delete(client.originals, client.originalOrder[0])
+		client.originalOrder = client.originalOrder[1:]
+	}
+}
+
+// findOriginal looks up a stored message
+func (client *WhatsAppClient) findOriginal(chat types.JID, messageID string) (storedMessage, bool) {
+	client.mutex.RLock()
+	defer client.mutex.RUnlock()
+
+	stored, exists := client.originals[storedMessageKey(chat, messageID)]
+	return stored, exists
+}
+
+// forwardableMedia returns the media part of a message, if any
+func forwardableMedia(msg *waE2E.Message) whatsmeow.DownloadableMessage {
+	switch {
+	case msg.GetImageMessage() != nil:
+		return msg.GetImageMessage()
+	case msg.GetVideoMessage() != nil:
+		return msg.GetVideoMessage()
+	case msg.GetAudioMessage() != nil:
+		return msg.GetAudioMessage()
+	case msg.GetDocumentMessage() != nil:
+		return msg.GetDocumentMessage()
+	case msg.GetStickerMessage() != nil:
+		return msg.GetStickerMessage()
+	}
+	return nil
+}
+
+// buildForwardMessage copies the original content and marks it as forwarded
+func buildForwardMessage(original *waE2E.Message) (*waE2E.Message, error) {
+	src := proto.Clone(original).(*waE2E.Message)
+	msg := &waE2E.Message{}
+
+	var contextInfo **waE2E.ContextInfo
+	switch {
+	case src.Conversation != nil:
+		// Plain text can't carry ContextInfo, so it becomes an extended text message
+		msg.ExtendedTextMessage = &waE2E.ExtendedTextMessage{Text: src.Conversation}
+		contextInfo = &msg.ExtendedTextMessage.ContextInfo
+	case src.ExtendedTextMessage != nil:
+		msg.ExtendedTextMessage = src.ExtendedTextMessage
+		contextInfo = &msg.ExtendedTextMessage.ContextInfo
+	case src.ImageMessage != nil:
+		msg.ImageMessage = src.ImageMessage
+		contextInfo = &msg.ImageMessage.ContextInfo
+	case src.VideoMessage != nil:
+		msg.VideoMessage = src.VideoMessage
+		contextInfo = &msg.VideoMessage.ContextInfo
+	case src.AudioMessage != nil:
+		msg.AudioMessage = src.AudioMessage
+		contextInfo = &msg.AudioMessage.ContextInfo
+	case src.DocumentMessage != nil:
+		msg.DocumentMessage = src.DocumentMessage
+		contextInfo = &msg.DocumentMessage.ContextInfo
+	case src.StickerMessage != nil:
+		msg.StickerMessage = src.StickerMessage
+		contextInfo = &msg.StickerMessage.ContextInfo
+	case src.LocationMessage != nil:
+		msg.LocationMessage = src.LocationMessage
+		contextInfo = &msg.LocationMessage.ContextInfo
+	case src.ContactMessage != nil:
+		msg.ContactMessage = src.ContactMessage
+		contextInfo = &msg.ContactMessage.ContextInfo
+	case src.ContactsArrayMessage != nil:
+		msg.ContactsArrayMessage = src.ContactsArrayMessage
+		contextInfo = &msg.ContactsArrayMessage.ContextInfo
+	default:
+		return nil, errors.New("message type cannot be forwarded")
+	}
+
+	// Drop quotes and mentions of the original chat, keep only the forwarding score
+	score := (*contextInfo).GetForwardingScore() + 1
+	*contextInfo = &waE2E.ContextInfo{
+		IsForwarded:     proto.Bool(true),
+		ForwardingScore: proto.Uint32(score),
+	}
+	return msg, nil
+}
+
+// reuploadMedia downloads the original media and uploads it again, replacing the media keys
+func reuploadMedia(ctx context.Context, client *WhatsAppClient, msg *waE2E.Message) error {
+	media := forwardableMedia(msg)
+	if media == nil {
+		return nil
+	}
+
+	data, err := client.client.Download(ctx, media)
+	if err != nil {
+		return fmt.Errorf("failed to download original media: %w", err)
+	}
+	uploaded, err := client.client.Upload(ctx, data, whatsmeow.GetMediaType(media))
+	if err != nil {
+		return fmt.Errorf("failed to upload media: %w", err)
+	}
+
+	switch m := media.(type) {
+	case *waE2E.ImageMessage:
+		m.URL, m.DirectPath, m.MediaKey = &uploaded.URL, &uploaded.DirectPath, uploaded.MediaKey
+		m.FileEncSHA256, m.FileSHA256, m.FileLength = uploaded.FileEncSHA256, uploaded.FileSHA256, &uploaded.FileLength
+	case *waE2E.VideoMessage:
+		m.URL, m.DirectPath, m.MediaKey = &uploaded.URL, &uploaded.DirectPath, uploaded.MediaKey
+		m.FileEncSHA256, m.FileSHA256, m.FileLength = uploaded.FileEncSHA256, uploaded.FileSHA256, &uploaded.FileLength
+	case *waE2E.AudioMessage:
+		m.URL, m.DirectPath, m.MediaKey = &uploaded.URL, &uploaded.DirectPath, uploaded.MediaKey
+		m.FileEncSHA256, m.FileSHA256, m.FileLength = uploaded.FileEncSHA256, uploaded.FileSHA256, &uploaded.FileLength
+	case *waE2E.DocumentMessage:
+		m.URL, m.DirectPath, m.MediaKey = &uploaded.URL, &uploaded.DirectPath, uploaded.MediaKey
+		m.FileEncSHA256, m.FileSHA256, m.FileLength = uploaded.FileEncSHA256, uploaded.FileSHA256, &uploaded.FileLength
+	case *waE2E.StickerMessage:
+		m.URL, m.DirectPath, m.MediaKey = &uploaded.URL, &uploaded.DirectPath, uploaded.MediaKey
+		m.FileEncSHA256, m.FileSHA256, m.FileLength = uploaded.FileEncSHA256, uploaded.FileSHA256, &uploaded.FileLength
+	}
+	return nil
+}
+
+// canReuseMedia reports whether the original upload can be referenced again as is
+func canReuseMedia(stored storedMessage, msg *waE2E.Message) bool {
+	media := forwardableMedia(msg)
+	if media == nil {
+		return false
+	}
+	if len(media.GetMediaKey()) == 0 || media.GetDirectPath() == "" {
+		return false
+	}
+	return time.Since(stored.Info.Timestamp) < mediaReuseMaxAge
+}
+
+// @Summary Forward message
+// @Description Forwards a received message, including media, to one or more chats. Media keys of the original upload are reused when still valid.
+// @Tags messages
+// @Accept json
+// @Produce json
+// @Param id path string true "Client ID"
+// @Param forward body ForwardMessageRequest true "Message and destinations"
+// @Success 200 {object} ForwardMessageResponse
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /clients/{id}/forward [post]
+func forwardMessage(c *gin.Context) {
+	clientID := c.Param("id")
+
+	waClient, err := manager.getClient(clientID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !waClient.isConnected {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "client is not connected"})
+		return
+	}
+
+	var req ForwardMessageRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	sourceChat, err := parseChatJID(clientID, req.Chat)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	destinations := make([]types.JID, len(req.Destinations))
+	for i, dest := range req.Destinations {
+		if destinations[i], err = manager.resolveRecipientFor(clientID, dest); err != nil {
+			recipientErr := err.(*RecipientError)
+			recipientErr.Field = fmt.Sprintf("destinations[%d]", i)
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("destination %s: %v", dest, err), "details": recipientErr})
+			return
+		}
+	}
+
+	stored, exists := waClient.findOriginal(sourceChat, req.MessageID)
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "message not found; only recently received messages can be forwarded"})
+		return
+	}
+
+	msg, err := buildForwardMessage(stored.Message)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx := context.Background()
+	mediaReused := canReuseMedia(stored, msg)
+	if forwardableMedia(msg) != nil && (req.Reupload || !mediaReused) {
+		// Upload once and share the new keys between all destinations
+		mediaReused = false
+		if err := reuploadMedia(ctx, waClient, msg); err != nil {
+			LogMedia.Error("Failed to re-upload media of %s for client %s: %v", req.MessageID, clientID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	response := ForwardMessageResponse{Success: true, Results: make([]ForwardResult, 0, len(destinations))}
+	for _, dest := range destinations {
+		result := ForwardResult{To: dest.String(), MediaReused: mediaReused}
+
+		resp, err := waClient.client.SendMessage(ctx, dest, msg)
+		if err != nil {
+			LogMessage.Error("Failed to forward %s to %s for client %s: %v", req.MessageID, dest.String(), clientID, err)
+			result.Error = err.Error()
+			response.Success = false
+		} else {
+			result.Success = true
+			result.MessageID = resp.ID
+		}
+		response.Results = append(response.Results, result)
+	}
+
+	LogMessage.Info("Forwarded %s from %s to %d chats for client %s", req.MessageID, sourceChat.String(), len(destinations), clientID)
+	c.JSON(http.StatusOK, response)
+}
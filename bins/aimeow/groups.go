@@ -0,0 +1,76 @@
+package main
+
+import (
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+func jidStrings(jids []types.JID) []string {
+	if len(jids) == 0 {
+		return nil
+	}
+	values := make([]string, 0, len(jids))
+	for _, jid := range jids {
+		values = append(values, jid.ToNonAD().String())
+	}
+	return values
+}
+
+// handleJoinedGroup reports a group the client was added to
+func (cm *ClientManager) handleJoinedGroup(clientID string, evt *events.JoinedGroup) {
+	if clientID == "" {
+		return
+	}
+
+	data := GroupJoinedData{
+		Group:        evt.JID.String(),
+		Name:         evt.Name,
+		Reason:       evt.Reason,
+		Type:         evt.Type,
+		Participants: make([]string, 0, len(evt.Participants)),
+	}
+	if evt.Sender != nil {
+		data.Sender = evt.Sender.ToNonAD().String()
+	}
+	for _, participant := range evt.Participants {
+		data.Participants = append(data.Participants, participant.JID.ToNonAD().String())
+	}
+	LogClient.Info("Client %s joined group %s (%s)", clientID, data.Group, data.Name)
+	cm.sendConnectionStatusWebhook(clientID, "group.joined", data)
+}
+
+// handleGroupInfo reports changes to a group's settings and members
+func (cm *ClientManager) handleGroupInfo(clientID string, evt *events.GroupInfo) {
+	if clientID == "" {
+		return
+	}
+
+	data := GroupChangedData{
+		Group:     evt.JID.String(),
+		Timestamp: evt.Timestamp.Unix(),
+		Deleted:   evt.Delete != nil,
+		Join:      jidStrings(evt.Join),
+		Leave:     jidStrings(evt.Leave),
+		Promote:   jidStrings(evt.Promote),
+		Demote:    jidStrings(evt.Demote),
+	}
+	if evt.Sender != nil {
+		data.Sender = evt.Sender.ToNonAD().String()
+	}
+	if evt.SenderPN != nil {
+		data.SenderPN = evt.SenderPN.ToNonAD().String()
+	}
+	if evt.Name != nil {
+		data.Name = &evt.Name.Name
+	}
+	if evt.Topic != nil {
+		data.Topic = &evt.Topic.Topic
+	}
+	if evt.Locked != nil {
+		data.Locked = &evt.Locked.IsLocked
+	}
+	if evt.Announce != nil {
+		data.Announce = &evt.Announce.IsAnnounce
+	}
+	cm.sendConnectionStatusWebhook(clientID, "group.changed", data)
+}
@@ -0,0 +1,397 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mau.fi/whatsmeow/proto/waHistorySync"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// Status of a JIDResolution
+const (
+	ResolutionResolved      = "resolved"       // the phone number is known
+	ResolutionUnresolved    = "unresolved"     // a LID whose phone number hasn't been seen yet
+	ResolutionNotApplicable = "not_applicable" // groups, newsletters and broadcasts have no phone number
+)
+
+// Where a LID ↔ phone pair was learned
+const (
+	SourceJID          = "jid"           // the phone number is the JID itself
+	SourceSenderAlt    = "sender_alt"    // alternate address on an incoming message
+	SourceRecipientAlt = "recipient_alt" // alternate address on a message sent from the phone
+	SourceHistorySync  = "history_sync"
+	SourceDeviceStore  = "device_store" // whatsmeow's own LID map
+	SourceUSync        = "usync"        // asked WhatsApp through a user info query
+)
+
+// maxResolveBatch bounds the JIDs accepted by the batch endpoint
+const maxResolveBatch = 500
+
+// JIDResolution is what is known about the phone number and LID behind a JID
+type JIDResolution struct {
+	Input     string `json:"input,omitempty"`
+	JID       string `json:"jid"`
+	Type      string `json:"type"` // user, lid, group, newsletter or other
+	Status    string `json:"status"`
+	Phone     string `json:"phone,omitempty"`
+	PhoneJID  string `json:"phoneJid,omitempty"`
+	LID       string `json:"lid,omitempty"`
+	Source    string `json:"source,omitempty"`
+	UpdatedAt int64  `json:"updatedAt,omitempty"` // Unix time the pair was learned
+	Error     string `json:"error,omitempty"`
+}
+
+type ResolveJIDsRequest struct {
+	JIDs    []string `json:"jids" binding:"required,min=1"`
+	Refresh bool     `json:"refresh,omitempty"` // ask WhatsApp for phone numbers without a known LID
+}
+
+type ResolveJIDsResponse struct {
+	Results []JIDResolution `json:"results"`
+}
+
+type lidMapping struct {
+	lid       types.JID
+	phone     types.JID
+	source    string
+	updatedAt time.Time
+}
+
+const jidMapSchema = `
+CREATE TABLE IF NOT EXISTS aimeow_jid_map (
+	client_id  TEXT    NOT NULL,
+	lid        TEXT    NOT NULL,
+	phone      TEXT    NOT NULL,
+	source     TEXT    NOT NULL,
+	updated_at INTEGER NOT NULL,
+	PRIMARY KEY (client_id, lid)
+);
+CREATE INDEX IF NOT EXISTS aimeow_jid_map_phone ON aimeow_jid_map (client_id, phone)`
+
+// initJIDResolver creates the LID ↔ phone cache table
+func initJIDResolver(ctx context.Context, db *sql.DB) error {
+	if _, err := db.ExecContext(ctx, jidMapSchema); err != nil {
+		return fmt.Errorf("failed to create JID map table: %w", err)
+	}
+	return nil
+}
+
+// jidType names the kind of address a JID is
+func jidType(jid types.JID) string {
+	if kind, ok := recipientServers[jid.Server]; ok {
+		return kind
+	}
+	return "other"
+}
+
+// rememberLIDMapping records a LID ↔ phone pair in the cache and in whatsmeow's LID store.
+// Pairs in any order are accepted; anything that isn't a LID and a phone JID is ignored.
+func (cm *ClientManager) rememberLIDMapping(ctx context.Context, client *WhatsAppClient, clientID string, first, second types.JID, source string) {
+	lid, phone := first.ToNonAD(), second.ToNonAD()
+	if lid.Server == types.DefaultUserServer {
+		lid, phone = phone, lid
+	}
+	if lid.Server != types.HiddenUserServer || phone.Server != types.DefaultUserServer || lid.User == "" || phone.User == "" {
+		return
+	}
+
+	if existing, err := cm.getLIDMapping(ctx, clientID, "lid=?", lid.String()); err == nil && existing != nil && existing.phone == phone {
+		return
+	}
+
+	_, err := cm.db.ExecContext(ctx, `
+		INSERT INTO aimeow_jid_map (client_id, lid, phone, source, updated_at) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (client_id, lid) DO UPDATE SET phone=excluded.phone, source=excluded.source, updated_at=excluded.updated_at`,
+		clientID, lid.String(), phone.String(), source, time.Now().Unix())
+	if err != nil {
+		LogLID.Warn("Failed to cache LID mapping %s -> %s: %v", lid, phone, err)
+		return
+	}
+	if source != SourceDeviceStore && client.deviceStore.LIDs != nil {
+		client.client.StoreLIDPNMapping(ctx, lid, phone)
+	}
+	LogLID.Debug("Learned LID mapping %s -> %s from %s", lid, phone, source)
+}
+
+// getLIDMapping looks up a cached pair by lid or phone. It returns nil if none is cached.
+func (cm *ClientManager) getLIDMapping(ctx context.Context, clientID string, condition string, value string) (*lidMapping, error) {
+	var lid, phone string
+	var updatedAt int64
+	mapping := &lidMapping{}
+	err := cm.db.QueryRowContext(ctx, "SELECT lid, phone, source, updated_at FROM aimeow_jid_map WHERE client_id=? AND "+condition+" ORDER BY updated_at DESC LIMIT 1",
+		clientID, value).Scan(&lid, &phone, &mapping.source, &updatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to get LID mapping: %w", err)
+	}
+	if mapping.lid, err = types.ParseJID(lid); err != nil {
+		return nil, err
+	}
+	if mapping.phone, err = types.ParseJID(phone); err != nil {
+		return nil, err
+	}
+	mapping.updatedAt = time.Unix(updatedAt, 0)
+	return mapping, nil
+}
+
+// deleteClientLIDMappings removes a client's cached pairs
+func (cm *ClientManager) deleteClientLIDMappings(ctx context.Context, clientID string) error {
+	if _, err := cm.db.ExecContext(ctx, "DELETE FROM aimeow_jid_map WHERE client_id=?", clientID); err != nil {
+		return fmt.Errorf("failed to delete LID mappings: %w", err)
+	}
+	return nil
+}
+
+// lookupLIDMapping finds the pair for a LID or phone JID in the cache, then in whatsmeow's LID store
+func (cm *ClientManager) lookupLIDMapping(ctx context.Context, client *WhatsAppClient, clientID string, jid types.JID) (*lidMapping, error) {
+	condition := "lid=?"
+	if jid.Server == types.DefaultUserServer {
+		condition = "phone=?"
+	}
+	if mapping, err := cm.getLIDMapping(ctx, clientID, condition, jid.String()); err != nil || mapping != nil {
+		return mapping, err
+	}
+
+	// whatsmeow learns pairs on its own too, e.g. from history sync and group metadata.
+	// Its LID store is only attached once the device is paired.
+	if client.deviceStore.LIDs == nil {
+		return nil, nil
+	}
+	var other types.JID
+	var err error
+	if jid.Server == types.HiddenUserServer {
+		other, err = client.deviceStore.LIDs.GetPNForLID(ctx, jid)
+	} else {
+		other, err = client.deviceStore.LIDs.GetLIDForPN(ctx, jid)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query device store: %w", err)
+	}
+	if other.IsEmpty() {
+		return nil, nil
+	}
+	cm.rememberLIDMapping(ctx, client, clientID, jid, other, SourceDeviceStore)
+
+	mapping := &lidMapping{lid: jid, phone: other, source: SourceDeviceStore, updatedAt: time.Now()}
+	if jid.Server == types.DefaultUserServer {
+		mapping.lid, mapping.phone = other, jid
+	}
+	return mapping, nil
+}
+
+// resolveJIDs resolves JIDs from the cache. With network set, phone numbers whose LID isn't
+// cached are looked up on WhatsApp in a single query; there is no such query for LIDs.
+func (cm *ClientManager) resolveJIDs(ctx context.Context, client *WhatsAppClient, clientID string, jids []types.JID, network bool) []JIDResolution {
+	results := make([]JIDResolution, len(jids))
+	var unknown []types.JID
+	unknownIndexes := make(map[types.JID][]int)
+
+	for i, jid := range jids {
+		jid = jid.ToNonAD()
+		res := JIDResolution{JID: jid.String(), Type: jidType(jid), Status: ResolutionNotApplicable}
+		switch jid.Server {
+		case types.DefaultUserServer:
+			res.Status = ResolutionResolved
+			res.Phone = jid.User
+			res.PhoneJID = jid.String()
+			res.Source = SourceJID
+		case types.HiddenUserServer:
+			res.Status = ResolutionUnresolved
+			res.LID = jid.String()
+		default:
+			results[i] = res
+			continue
+		}
+
+		mapping, err := cm.lookupLIDMapping(ctx, client, clientID, jid)
+		if err != nil {
+			LogLID.Warn("Failed to look up %s: %v", jid, err)
+			res.Error = err.Error()
+		} else if mapping != nil {
+			res.applyMapping(mapping)
+		} else if jid.Server == types.DefaultUserServer && network {
+			if _, queued := unknownIndexes[jid]; !queued {
+				unknown = append(unknown, jid)
+			}
+			unknownIndexes[jid] = append(unknownIndexes[jid], i)
+		}
+		results[i] = res
+	}
+
+	if len(unknown) > 0 {
+		infos, err := client.client.GetUserInfo(ctx, unknown)
+		if err != nil {
+			LogLID.Warn("Failed to query user info for %d numbers: %v", len(unknown), err)
+		}
+		for jid, info := range infos {
+			if info.LID.IsEmpty() {
+				continue
+			}
+			cm.rememberLIDMapping(ctx, client, clientID, info.LID, jid, SourceUSync)
+			now := time.Now()
+			for _, i := range unknownIndexes[jid] {
+				results[i].applyMapping(&lidMapping{lid: info.LID, phone: jid, source: SourceUSync, updatedAt: now})
+			}
+		}
+	}
+	return results
+}
+
+func (res *JIDResolution) applyMapping(mapping *lidMapping) {
+	res.Status = ResolutionResolved
+	res.Phone = mapping.phone.User
+	res.PhoneJID = mapping.phone.String()
+	res.LID = mapping.lid.String()
+	res.Source = mapping.source
+	res.UpdatedAt = mapping.updatedAt.Unix()
+}
+
+// learnMessageMappings caches the pairs carried by a message's alternate addresses
+func (cm *ClientManager) learnMessageMappings(ctx context.Context, client *WhatsAppClient, clientID string, info types.MessageInfo) {
+	if !info.SenderAlt.IsEmpty() {
+		cm.rememberLIDMapping(ctx, client, clientID, info.Sender, info.SenderAlt, SourceSenderAlt)
+	}
+	if !info.RecipientAlt.IsEmpty() && !info.IsGroup {
+		cm.rememberLIDMapping(ctx, client, clientID, info.Chat, info.RecipientAlt, SourceRecipientAlt)
+	}
+}
+
+// resolveMessageSender works out who a message webhook is "from" without network calls.
+// In direct chats that is the chat, in groups and broadcasts the sender.
+func (cm *ClientManager) resolveMessageSender(ctx context.Context, client *WhatsAppClient, clientID string, info types.MessageInfo) JIDResolution {
+	subject := info.Sender
+	if !info.IsGroup && (info.Chat.Server == types.DefaultUserServer || info.Chat.Server == types.HiddenUserServer) {
+		subject = info.Chat
+	}
+	return cm.resolveJIDs(ctx, client, clientID, []types.JID{subject}, false)[0]
+}
+
+// learnHistorySyncMappings caches the LID ↔ phone pairs carried by a history sync
+func (cm *ClientManager) learnHistorySyncMappings(client *WhatsAppClient, clientID string, data *waHistorySync.HistorySync) {
+	ctx := context.Background()
+	count := 0
+	learn := func(first, second string) {
+		a, errA := types.ParseJID(first)
+		b, errB := types.ParseJID(second)
+		if errA == nil && errB == nil {
+			cm.rememberLIDMapping(ctx, client, clientID, a, b, SourceHistorySync)
+			count++
+		}
+	}
+
+	for _, mapping := range data.GetPhoneNumberToLidMappings() {
+		learn(mapping.GetLidJID(), mapping.GetPnJID())
+	}
+	for _, conv := range data.GetConversations() {
+		switch {
+		case conv.GetPnJID() != "" && strings.HasSuffix(conv.GetID(), "@"+types.HiddenUserServer):
+			learn(conv.GetID(), conv.GetPnJID())
+		case conv.GetLidJID() != "" && strings.HasSuffix(conv.GetID(), "@"+types.DefaultUserServer):
+			learn(conv.GetLidJID(), conv.GetID())
+		}
+	}
+	if count > 0 {
+		LogLID.Info("Processed %d LID mappings from history sync for client %s", count, clientID)
+	}
+}
+
+// historySyncTasks queues the mapping import of a history sync event
+func (cm *ClientManager) historySyncTasks(client *WhatsAppClient, clientID string, evt *events.HistorySync) []eventTask {
+	if clientID == "" {
+		return nil
+	}
+	return []eventTask{{lane: resolverLane, run: func() {
+		cm.learnHistorySyncMappings(client, clientID, evt.Data)
+	}}}
+}
+
+// @Summary Resolve a JID
+// @Description Returns the phone number behind a LID, or the LID of a phone number, from the persistent cache. Phone numbers without a cached LID are looked up on WhatsApp.
+// @Tags contacts
+// @Produce json
+// @Param id path string true "Client ID"
+// @Param jid path string true "LID, JID or phone number"
+// @Success 200 {object} JIDResolution
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /clients/{id}/resolve/{jid} [get]
+func resolveJID(c *gin.Context) {
+	clientID := c.Param("id")
+
+	waClient, err := manager.getClient(clientID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	input := c.Param("jid")
+	jid, ok := bindRecipient(c, clientID, input, "")
+	if !ok {
+		return
+	}
+
+	res := manager.resolveJIDs(c.Request.Context(), waClient, clientID, []types.JID{jid}, waClient.isConnected)[0]
+	res.Input = input
+	c.JSON(http.StatusOK, res)
+}
+
+// @Summary Resolve several JIDs
+// @Description Resolves up to 500 LIDs, JIDs or phone numbers. Phone numbers without a cached LID are only looked up on WhatsApp with "refresh": true.
+// @Tags contacts
+// @Accept json
+// @Produce json
+// @Param id path string true "Client ID"
+// @Param request body ResolveJIDsRequest true "JIDs to resolve"
+// @Success 200 {object} ResolveJIDsResponse
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /clients/{id}/resolve [post]
+func resolveJIDsBatch(c *gin.Context) {
+	clientID := c.Param("id")
+
+	waClient, err := manager.getClient(clientID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	var req ResolveJIDsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if len(req.JIDs) > maxResolveBatch {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("too many JIDs: %d (max %d)", len(req.JIDs), maxResolveBatch)})
+		return
+	}
+
+	// Invalid entries are reported in place rather than failing the whole batch
+	var jids []types.JID
+	var positions []int
+	results := make([]JIDResolution, len(req.JIDs))
+	for i, input := range req.JIDs {
+		jid, err := manager.resolveRecipientFor(clientID, input)
+		if err != nil {
+			results[i] = JIDResolution{Input: input, Status: ResolutionUnresolved, Error: err.Error()}
+			continue
+		}
+		jids = append(jids, jid)
+		positions = append(positions, i)
+	}
+
+	network := req.Refresh && waClient.isConnected
+	for j, res := range manager.resolveJIDs(c.Request.Context(), waClient, clientID, jids, network) {
+		res.Input = req.JIDs[positions[j]]
+		results[positions[j]] = res
+	}
+	c.JSON(http.StatusOK, ResolveJIDsResponse{Results: results})
+}
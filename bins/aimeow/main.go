@@ -3,10 +3,14 @@ package main
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
+	"database/sql"
 	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io"
+	"mime"
 	"net/http"
 	"os"
 	"path/filepath"
@@ -61,23 +65,63 @@ type WhatsAppClient struct {
 	qrCode       string
 	connectedAt  *time.Time
 	messages     []string
-	images       map[string]string      // image_id -> file_path
 	osName       string                 // OS name to set after connection
 	typingTimers map[string]*time.Timer // chat_id -> typing timer
 	typingActive map[string]bool        // chat_id -> is currently typing
+	qrTimedOut   bool                   // pairing window closed without a scan
+	pairing      bool                   // a startPairing run is active
 	mutex        sync.RWMutex
+
+	// Connection state machine and reconnect supervisor
+	state             ConnectionState
+	stateReason       string
+	stateChangedAt    *time.Time
+	reconnectAttempts int
+	reconnectTimer    *time.Timer
+	nextReconnectAt   *time.Time
+	manualDisconnect  bool // set by /disconnect; suppresses automatic reconnects
+
+	qrSubscribers map[chan qrUpdate]struct{} // pairing page listeners
+	qrMutex       sync.Mutex
+
+	pausedChats map[string]*ChatPause // chat_id -> human takeover
+	pauseMutex  sync.Mutex
+
+	profile OwnProfile // last known about text and picture of the linked account
+
+	contactProfiles map[string]ContactProfile // jid -> cached profile lookup
+	contactMutex    sync.Mutex
+
+	avatarLocks map[string]*sync.Mutex // avatar dir -> fetch lock
+	avatarMutex sync.Mutex
+
+	originals     map[string]storedMessage // chat/message_id -> original, for forwarding
+	originalOrder []string                 // keys of originals, oldest first
+
+	undecryptable map[string]*time.Timer // chat/message_id -> pending message.undecryptable report
+
+	events *eventQueue // ordered work produced by events, run outside mutex
 }
 
 type ClientManager struct {
 	clients            map[string]*WhatsAppClient
 	container          *sqlstore.Container
+	db                 *sql.DB // Same database as container, for aimeow's own tables
 	callbackURL        string
-	configPath         string                   // Path to configuration file
-	clientIDMap        map[string]string        // Maps WhatsApp device ID -> UUID
-	clientMapPath      string                   // Path to client ID mapping file
-	pendingClients     map[string]PendingClient // Maps clientID -> PendingClient
-	pendingClientsPath string                   // Path to pending clients file
+	configPath         string                    // Path to configuration file
+	clientIDMap        map[string]string         // Maps WhatsApp device ID -> UUID
+	clientMapPath      string                    // Path to client ID mapping file
+	pendingClients     map[string]PendingClient  // Maps clientID -> PendingClient
+	pendingClientsPath string                    // Path to pending clients file
+	clientSettings     map[string]ClientSettings // Maps clientID -> ClientSettings
+	clientSettingsPath string                    // Path to client settings file
+	mediaJobs          chan mediaJob             // Pending media downloads, see startMediaWorkers
 	mutex              sync.RWMutex
+
+	// Webhook subscriptions by ID, guarded by subscriptionsMutex; see subscriptions.go
+	subscriptions      map[string]WebhookSubscription
+	subscriptionsMutex sync.RWMutex
+	subscriptionWrites sync.Mutex // serializes changes so a name check still holds when the map is updated
 }
 
 // Config represents the persistent configuration
@@ -106,7 +150,7 @@ var manager *ClientManager
 var baseURL string // Base URL for generating file URLs in webhooks
 var dataDir string // Data directory for storing files and database
 
-func NewClientManager(container *sqlstore.Container, configPath string) *ClientManager {
+func NewClientManager(container *sqlstore.Container, db *sql.DB, configPath string) *ClientManager {
 	// Derive client map path from config path
 	configDir := filepath.Dir(configPath)
 	clientMapPath := filepath.Join(configDir, "client_mappings.json")
@@ -115,12 +159,16 @@ func NewClientManager(container *sqlstore.Container, configPath string) *ClientM
 	cm := &ClientManager{
 		clients:            make(map[string]*WhatsAppClient),
 		container:          container,
+		db:                 db,
 		callbackURL:        "",
 		configPath:         configPath,
 		clientIDMap:        make(map[string]string),
 		clientMapPath:      clientMapPath,
 		pendingClients:     make(map[string]PendingClient),
 		pendingClientsPath: pendingClientsPath,
+		clientSettings:     make(map[string]ClientSettings),
+		clientSettingsPath: clientSettingsPathFor(configPath),
+		subscriptions:      make(map[string]WebhookSubscription),
 	}
 	// Load configuration from file
 	if err := cm.loadConfig(); err != nil {
@@ -139,6 +187,14 @@ func NewClientManager(container *sqlstore.Container, configPath string) *ClientM
 	if err := cm.loadPendingClients(); err != nil {
 		LogConfig.Warn("Failed to load pending clients (will use defaults): %v", err)
 	}
+	// Load per-client settings
+	if err := cm.loadClientSettings(); err != nil {
+		LogConfig.Warn("Failed to load client settings (will use defaults): %v", err)
+	}
+	// Load webhook subscriptions
+	if err := cm.loadWebhookSubscriptions(context.Background()); err != nil {
+		LogConfig.Warn("Failed to load webhook subscriptions: %v", err)
+	}
 	return cm
 }
 
@@ -317,25 +373,10 @@ func (cm *ClientManager) createClient(osName string, customID string) (*WhatsApp
 		return nil, "", fmt.Errorf("failed to create new device: container returned nil")
 	}
 
-	clientLog := waLog.Stdout("Client", "DEBUG", true)
-	client := whatsmeow.NewClient(deviceStore, clientLog)
+	waClient := cm.newWhatsAppClient(deviceStore, osName)
+	waClient.state = StatePairing
 	LogClient.Info("Created new client: %s", clientID)
 
-
-
-	waClient := &WhatsAppClient{
-		client:       client,
-		deviceStore:  deviceStore,
-		isConnected:  false,
-		messages:     make([]string, 0),
-		images:       make(map[string]string),
-		osName:       osName, // Store OS name for later setting
-		typingTimers: make(map[string]*time.Timer),
-		typingActive: make(map[string]bool),
-	}
-
-	client.AddEventHandler(cm.eventHandler(waClient))
-
 	// Store client with our generated UUID-based ID
 	cm.mutex.Lock()
 	manager.clients[clientID] = waClient
@@ -361,6 +402,34 @@ func (cm *ClientManager) createClient(osName string, customID string) (*WhatsApp
 	return waClient, clientID, nil
 }
 
+// newWhatsAppClient wraps a device store in a whatsmeow client with our event handler attached.
+// Automatic reconnects are handled by our own supervisor rather than whatsmeow's.
+func (cm *ClientManager) newWhatsAppClient(deviceStore *store.Device, osName string) *WhatsAppClient {
+	clientLog := waLog.Stdout("Client", "DEBUG", true)
+	client := whatsmeow.NewClient(deviceStore, clientLog)
+	client.EnableAutoReconnect = false
+
+	waClient := &WhatsAppClient{
+		client:          client,
+		deviceStore:     deviceStore,
+		isConnected:     false,
+		messages:        make([]string, 0),
+		osName:          osName, // Store OS name for later setting
+		typingTimers:    make(map[string]*time.Timer),
+		typingActive:    make(map[string]bool),
+		state:           StateDisconnected,
+		pausedChats:     make(map[string]*ChatPause),
+		contactProfiles: make(map[string]ContactProfile),
+		avatarLocks:     make(map[string]*sync.Mutex),
+		originals:       make(map[string]storedMessage),
+		undecryptable:   make(map[string]*time.Timer),
+		events:          newEventQueue(),
+	}
+
+	client.AddEventHandler(cm.eventHandler(waClient))
+	return waClient
+}
+
 func (cm *ClientManager) getClient(clientID string) (*WhatsAppClient, error) {
 	cm.mutex.RLock()
 	defer cm.mutex.RUnlock()
@@ -386,197 +455,336 @@ func (cm *ClientManager) getAllClients() map[string]*WhatsAppClient {
 
 func (cm *ClientManager) eventHandler(client *WhatsAppClient) func(interface{}) {
 	return func(evt interface{}) {
-		client.mutex.Lock()
-		defer client.mutex.Unlock()
-
-		switch v := evt.(type) {
-		case *events.Message:
-			message := fmt.Sprintf("Message: %s", v.Message.GetConversation())
-			client.messages = append(client.messages, message)
-			if len(client.messages) > 100 { // Keep last 100 messages
-				client.messages = client.messages[1:]
-			}
+		// Bookkeeping happens under the lock; anything slow is queued and runs once it's released
+		tasks := cm.handleEvent(client, evt)
+		client.events.submit(tasks...)
+	}
+}
 
-			// Store LID to phone number mapping using whatsmeow's built-in method
-			if v.Info.SenderAlt.User != "" && (v.Info.Chat.User != "" || v.Info.Sender.User != "") {
-				var lidJID types.JID
-				var phoneJID types.JID
-
-				// Identify LID and phone JIDs
-				if strings.Contains(v.Info.Chat.String(), "@lid") {
-					lidJID = v.Info.Chat
-					phoneJID = v.Info.SenderAlt
-				} else if strings.Contains(v.Info.Sender.String(), "@lid") {
-					lidJID = v.Info.Sender
-					phoneJID = v.Info.SenderAlt
-				}
+// handleEvent updates the client for an event and returns the work it triggers, in order
+func (cm *ClientManager) handleEvent(client *WhatsAppClient, evt interface{}) (tasks []eventTask) {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
 
-				if lidJID.User != "" && phoneJID.User != "" {
-					// Use whatsmeow's built-in LID to phone number mapping
-					client.client.StoreLIDPNMapping(context.Background(), lidJID, phoneJID)
-					LogMessage.Info("Stored mapping using whatsmeow: %s -> %s", lidJID.String(), phoneJID.String())
-				}
+	switch v := evt.(type) {
+	case *events.Message:
+		clientID := cm.clientIDFor(client)
+		settings := cm.getClientSettings(clientID)
+		chat := v.Info.Chat.String() // lane keeping this chat's work in order
+
+		message := fmt.Sprintf("Message: %s", v.Message.GetConversation())
+		client.messages = append(client.messages, message)
+		if len(client.messages) > 100 { // Keep last 100 messages
+			client.messages = client.messages[1:]
+		}
+		client.storeOriginal(v)
+
+		// Learn the LID ↔ phone pair on the message before anything in this chat resolves it
+		if clientID != "" && (!v.Info.SenderAlt.IsEmpty() || !v.Info.RecipientAlt.IsEmpty()) {
+			tasks = append(tasks, eventTask{lane: chat, run: func() {
+				cm.learnMessageMappings(context.Background(), client, clientID, v.Info)
+			}})
+		}
+
+		// The sender key of a group message arrives as its own part, under the same ID as the content
+		if isPlaceholderMessage(v.Message) {
+			LogMessage.Debug("Skipping content-less part of message %s in %s", v.Info.ID, chat)
+			return
+		}
+		client.resolveUndecryptable(v.Info)
+
+		// A reply typed on the phone means a human has taken over this chat
+		if settings.PauseOnOperatorReply && isOperatorReply(client, v.Info) {
+			if _, pauseTasks := cm.pauseChat(client, clientID, v.Info.Chat, PauseReasonOperatorReply, settings.pauseIdleTimeout()); len(pauseTasks) > 0 {
+				tasks = append(tasks, pauseTasks...)
+				tasks = append(tasks, eventTask{lane: chat, run: func() {
+					cm.stopTyping(client, v.Info.Chat)
+				}})
 			}
+		}
+		chatPaused := client.isChatPaused(v.Info.Chat)
 
-			// Mark message as read and start typing
-			if !v.Info.IsFromMe {
-				chatJID := v.Info.Chat
-				go func() {
-					// Mark as read
+		// Skip groups, status broadcasts or own messages if the client is configured to ignore them
+		if settings.ignores(v) {
+			LogMessage.Debug("Ignoring message %s in %s per client settings", v.Info.ID, v.Info.Chat.String())
+			return
+		}
+
+		// Mark message as read and start typing, unless a human operator has taken over the chat
+		if !v.Info.IsFromMe && !chatPaused && (settings.AutoRead || settings.AutoTyping) {
+			chatJID := v.Info.Chat
+			tasks = append(tasks, eventTask{lane: chat, run: func() {
+				// Mark as read
+				if settings.AutoRead {
 					err := client.client.MarkRead(context.Background(), []types.MessageID{v.Info.ID}, v.Info.Timestamp, chatJID, v.Info.Sender)
 					if err != nil {
 						LogMessage.Error("Failed to mark message as read: %v", err)
 					} else {
 						LogMessage.Info("Marked message as read from %s", chatJID.String())
 					}
+				}
 
-					// Start typing indicator
-					cm.startTyping(client, chatJID)
-				}()
-			}
-
-			// Download media first if message contains media (synchronous to ensure fileUrl is available)
-			// Note: Location messages (static and live) don't have downloadable files
-			if v.Message.GetImageMessage() != nil || v.Message.GetVideoMessage() != nil || v.Message.GetAudioMessage() != nil || v.Message.GetDocumentMessage() != nil {
-				LogMedia.Info("Media message detected for client %s, downloading before webhook...", client.deviceStore.ID.String())
-				// Release mutex during download to avoid blocking other operations
-				client.mutex.Unlock()
-				cm.downloadImage(client, v)
-				client.mutex.Lock()
-			}
-
-			// Send webhook callback if configured (now includes fileUrl for media messages)
-			if cm.callbackURL != "" {
-				go cm.sendWebhook(client, v)
-			}
-		case *events.Connected:
-			client.isConnected = true
-			now := time.Now()
-			client.connectedAt = &now
-
-			// Save device store to database after successful connection
-			// This is CRITICAL for WhatsApp pairing persistence
-			// Device JID is now available, so we can save to database
-			if client.deviceStore.ID != nil {
-				err := cm.container.PutDevice(context.Background(), client.deviceStore)
-				if err != nil {
-					LogClient.Warn("Failed to save device store after connection: %v", err)
-				} else {
-					LogClient.Info("Device store saved to database after successful connection")
+				// Start typing indicator
+				if settings.AutoTyping {
+					cm.startTyping(client, chatJID, settings.typingTimeout())
 				}
-			}
+			}})
+		}
 
-			// Set OS name if provided and device has JID
-			if client.osName != "" && client.deviceStore.ID != nil {
-				store.DeviceProps.Os = &client.osName
-			}
+		// Log the message and send it to the callback URL and subscriptions
+		if clientID != "" {
+			tasks = append(tasks, eventTask{lane: chat, run: func() {
+				cm.sendWebhook(client, v)
+			}})
+		}
 
-			// Save the mapping from WhatsApp device ID to our UUID
-			// Find our UUID for this client by searching through manager.clients
-			var ourUUID string
-			if client.deviceStore.ID != nil {
-				whatsappID := client.deviceStore.ID.String()
-				cm.mutex.Lock()
-				// Find the UUID key for this client
-				for uuid, c := range cm.clients {
-					if c == client {
-						ourUUID = uuid
-						break
-					}
-				}
-				if ourUUID != "" {
-					cm.clientIDMap[whatsappID] = ourUUID
-
-					// Remove from pending clients since it's now connected
-					if _, exists := cm.pendingClients[ourUUID]; exists {
-						delete(cm.pendingClients, ourUUID)
-						cm.mutex.Unlock()
-						// Save updated pending clients to disk
-						if err := cm.savePendingClients(); err != nil {
-							LogClient.Warn("Failed to save pending clients: %v", err)
-						} else {
-							LogClient.Info("Removed client from pending list: %s", ourUUID)
-						}
-					} else {
-						cm.mutex.Unlock()
-					}
+		// Media is downloaded in the background; the webhook goes out now and media.ready or media.failed follows
+		// Note: Location messages (static and live) don't have downloadable files
+		if settings.AutoDownloadMedia && hasDownloadableMedia(v.Message) {
+			tasks = append(tasks, cm.enqueueMediaDownload(client, clientID, v)...)
+		}
+	case *events.UndecryptableMessage:
+		cm.trackUndecryptable(client, cm.clientIDFor(client), v)
+	case *events.HistorySync:
+		tasks = append(tasks, cm.historySyncTasks(client, cm.clientIDFor(client), v)...)
+	case *events.Connected:
+		client.reconnectAttempts = 0
+		client.cancelReconnect()
+		cm.setState(client, cm.clientIDFor(client), StateConnected, "", StateChangedData{})
+		now := time.Now()
+		client.connectedAt = &now
+
+		// Set OS name if provided and device has JID
+		if client.osName != "" && client.deviceStore.ID != nil {
+			store.DeviceProps.Os = &client.osName
+		}
 
-					// Save mappings to disk
-					if err := cm.saveClientMappings(); err != nil {
-						LogClient.Warn("Failed to save client mappings: %v", err)
-					} else {
-						LogConfig.Info("Saved client mapping: %s -> %s", whatsappID, ourUUID)
-					}
-				} else {
-					cm.mutex.Unlock()
+		// Save the mapping from WhatsApp device ID to our UUID
+		// Find our UUID for this client by searching through manager.clients
+		var ourUUID string
+		var wasPending bool
+		if client.deviceStore.ID != nil {
+			whatsappID := client.deviceStore.ID.String()
+			cm.mutex.Lock()
+			// Find the UUID key for this client
+			for uuid, c := range cm.clients {
+				if c == client {
+					ourUUID = uuid
+					break
 				}
 			}
-
-			// Send connection status webhook after successful connection
 			if ourUUID != "" {
-				go cm.sendConnectionStatusWebhook(ourUUID, "connected", map[string]interface{}{
-					"osName":      client.osName,
-					"connectedAt": now.Format(time.RFC3339),
-					"phone":       client.deviceStore.ID.User,
-				})
-			}
-		case *events.LoggedOut:
-			client.isConnected = false
-			client.connectedAt = nil
+				cm.clientIDMap[whatsappID] = ourUUID
 
-			// Send disconnection status webhook
-			cm.mutex.RLock()
-			whatsappID := client.deviceStore.ID.String()
-			clientID, exists := cm.clientIDMap[whatsappID]
-			if !exists {
-				// Try to find the UUID by searching
-				for uuid, c := range cm.clients {
-					if c == client {
-						clientID = uuid
-						break
-					}
-				}
+				// Remove from pending clients since it's now connected
+				_, wasPending = cm.pendingClients[ourUUID]
+				delete(cm.pendingClients, ourUUID)
 			}
-			cm.mutex.RUnlock()
+			cm.mutex.Unlock()
+		}
 
-			if clientID != "" {
-				go cm.sendConnectionStatusWebhook(clientID, "disconnected", map[string]interface{}{})
+		// Write the device store and mappings to disk once the lock is released
+		tasks = append(tasks, eventTask{lane: clientLane, run: func() {
+			cm.persistConnectedClient(client, ourUUID, wasPending)
+		}})
+
+		client.qrCode = ""
+		client.qrTimedOut = false
+		client.publishQR(qrUpdate{Event: qrEventConnected})
+
+		// Send connection status webhook after successful connection
+		if ourUUID != "" {
+			data := ConnectedData{
+				OSName:      client.osName,
+				ConnectedAt: now.Unix(),
+				Phone:       client.deviceStore.ID.User,
 			}
-		case *events.QR:
-			client.qrCode = v.Codes[0]
-
-			// Send QR code webhook
-			cm.mutex.RLock()
-			var clientID string
-			// Only try to get whatsappID if deviceStore.ID is not nil
-			if client.deviceStore.ID != nil {
-				whatsappID := client.deviceStore.ID.String()
-				clientID, _ = cm.clientIDMap[whatsappID]
+			tasks = append(tasks, eventTask{lane: clientLane, run: func() {
+				cm.sendConnectionStatusWebhook(ourUUID, "connected", data)
+			}}, eventTask{lane: profileLane, run: func() {
+				cm.refreshOwnProfile(client, ourUUID)
+			}})
+		}
+	case *events.LoggedOut:
+		client.cancelReconnect()
+
+		// Send disconnection status webhook
+		clientID := cm.clientIDFor(client)
+		cm.setState(client, clientID, StateLoggedOut, v.Reason.String(), StateChangedData{
+			OnConnect: &v.OnConnect,
+		})
+
+		if clientID != "" {
+			tasks = append(tasks, eventTask{lane: clientLane, run: func() {
+				cm.sendConnectionStatusWebhook(clientID, "disconnected", EmptyData{})
+			}})
+		}
+	case *events.PairSuccess:
+		cm.setState(client, cm.clientIDFor(client), StateConnecting, "paired", StateChangedData{
+			Phone:    v.ID.User,
+			Platform: v.Platform,
+		})
+	case *events.Disconnected:
+		clientID := cm.clientIDFor(client)
+		if client.deviceStore.ID != nil && !client.manualDisconnect {
+			cm.scheduleReconnect(client, clientID, 0, StateReconnecting, "connection closed by server", StateChangedData{})
+		} else {
+			cm.setState(client, clientID, StateDisconnected, "connection closed by server", StateChangedData{})
+		}
+	case *events.StreamReplaced:
+		// Another connection took over this session; reconnecting would just fight it
+		client.cancelReconnect()
+		cm.setState(client, cm.clientIDFor(client), StateDisconnected, "stream replaced by another connection", StateChangedData{})
+	case *events.ClientOutdated:
+		client.cancelReconnect()
+		cm.setState(client, cm.clientIDFor(client), StateDisconnected, "client outdated", StateChangedData{})
+	case *events.TemporaryBan:
+		clientID := cm.clientIDFor(client)
+		banCode := int(v.Code)
+		data := StateChangedData{BanCode: &banCode}
+		if v.Expire > 0 {
+			// Try again once the ban has expired
+			client.reconnectAttempts = 0
+			cm.scheduleReconnect(client, clientID, v.Expire, StateBanned, v.String(), data)
+		} else {
+			client.cancelReconnect()
+			cm.setState(client, clientID, StateBanned, v.String(), data)
+		}
+	case *events.ConnectFailure:
+		clientID := cm.clientIDFor(client)
+		if v.Reason.IsLoggedOut() {
+			client.cancelReconnect()
+			cm.setState(client, clientID, StateLoggedOut, v.Reason.String(), StateChangedData{})
+		} else if client.deviceStore.ID != nil && !client.manualDisconnect {
+			cm.scheduleReconnect(client, clientID, 0, StateReconnecting, v.Reason.String(), StateChangedData{})
+		}
+	case *events.KeepAliveTimeout:
+		clientID := cm.clientIDFor(client)
+		if clientID != "" {
+			data := KeepAliveTimeoutData{
+				ErrorCount:  v.ErrorCount,
+				LastSuccess: v.LastSuccess.Unix(),
 			}
-			// If not found in map, try to find the UUID by searching
-			if clientID == "" {
-				for uuid, c := range cm.clients {
-					if c == client {
-						clientID = uuid
-						break
-					}
+			tasks = append(tasks, eventTask{lane: clientLane, run: func() {
+				cm.sendConnectionStatusWebhook(clientID, "keepalive_timeout", data)
+			}})
+		}
+		// The socket is probably dead; force a reconnect instead of waiting for TCP to notice
+		if v.ErrorCount >= keepAliveReconnectThreshold && client.state == StateConnected && !client.manualDisconnect {
+			go client.client.Disconnect()
+			cm.scheduleReconnect(client, clientID, 0, StateReconnecting, "keepalive timeout", StateChangedData{})
+		}
+	case *events.KeepAliveRestored:
+		if clientID := cm.clientIDFor(client); clientID != "" {
+			tasks = append(tasks, eventTask{lane: clientLane, run: func() {
+				cm.sendConnectionStatusWebhook(clientID, "keepalive_restored", EmptyData{})
+			}})
+		}
+	case *events.CallOffer:
+		clientID := cm.clientIDFor(client)
+		tasks = append(tasks, eventTask{lane: callLane(v.BasicCallMeta), run: func() {
+			cm.handleIncomingCall(client, clientID, v.BasicCallMeta, callMedia(v), false)
+		}})
+	case *events.CallOfferNotice:
+		clientID := cm.clientIDFor(client)
+		tasks = append(tasks, eventTask{lane: callLane(v.BasicCallMeta), run: func() {
+			cm.handleIncomingCall(client, clientID, v.BasicCallMeta, v.Media, v.Type == "group")
+		}})
+	case *events.CallAccept:
+		clientID := cm.clientIDFor(client)
+		tasks = append(tasks, eventTask{lane: callLane(v.BasicCallMeta), run: func() {
+			cm.handleCallEvent(clientID, "call.accepted", newCallData(v.BasicCallMeta))
+		}})
+	case *events.CallReject:
+		clientID := cm.clientIDFor(client)
+		tasks = append(tasks, eventTask{lane: callLane(v.BasicCallMeta), run: func() {
+			cm.handleCallEvent(clientID, "call.rejected", newCallData(v.BasicCallMeta))
+		}})
+	case *events.CallTerminate:
+		clientID := cm.clientIDFor(client)
+		tasks = append(tasks, eventTask{lane: callLane(v.BasicCallMeta), run: func() {
+			cm.handleCallEvent(clientID, "call.terminated", CallTerminatedData{
+				CallData: newCallData(v.BasicCallMeta),
+				Reason:   v.Reason,
+			})
+		}})
+	case *events.Picture:
+		clientID := cm.clientIDFor(client)
+		tasks = append(tasks, eventTask{lane: v.JID.ToNonAD().String(), run: func() {
+			cm.handlePictureEvent(client, clientID, v.JID, v.Remove)
+		}})
+	case *events.Blocklist:
+		clientID := cm.clientIDFor(client)
+		tasks = append(tasks, eventTask{lane: clientLane, run: func() {
+			cm.handleBlocklistEvent(client, clientID, v)
+		}})
+	case *events.Receipt:
+		// Receipts are frequent and only go to subscriptions that ask for them
+		clientID := cm.clientIDFor(client)
+		if len(cm.webhookTargets(clientID, "receipt")) > 0 {
+			tasks = append(tasks, eventTask{lane: v.Chat.String(), run: func() {
+				cm.handleReceipt(clientID, v)
+			}})
+		}
+	case *events.JoinedGroup:
+		clientID := cm.clientIDFor(client)
+		tasks = append(tasks, eventTask{lane: v.JID.String(), run: func() {
+			cm.handleJoinedGroup(clientID, v)
+		}})
+	case *events.GroupInfo:
+		clientID := cm.clientIDFor(client)
+		tasks = append(tasks, eventTask{lane: v.JID.String(), run: func() {
+			cm.handleGroupInfo(clientID, v)
+		}})
+	case *events.QR:
+		client.qrCode = v.Codes[0]
+		cm.setState(client, cm.clientIDFor(client), StatePairing, "", StateChangedData{})
+
+		// Send QR code webhook
+		cm.mutex.RLock()
+		var clientID string
+		// Only try to get whatsappID if deviceStore.ID is not nil
+		if client.deviceStore.ID != nil {
+			whatsappID := client.deviceStore.ID.String()
+			clientID, _ = cm.clientIDMap[whatsappID]
+		}
+		// If not found in map, try to find the UUID by searching
+		if clientID == "" {
+			for uuid, c := range cm.clients {
+				if c == client {
+					clientID = uuid
+					break
 				}
 			}
-			cm.mutex.RUnlock()
+		}
+		cm.mutex.RUnlock()
 
-			if clientID != "" {
-				go cm.sendConnectionStatusWebhook(clientID, "qr_code", map[string]interface{}{
-					"qrCode": v.Codes[0],
-				})
+		if clientID != "" {
+			data := QRCodeData{QRCode: v.Codes[0]}
+			if qrImage, err := qrDataURI(v.Codes[0]); err == nil {
+				data.QRImage = qrImage
+			} else {
+				LogQR.Warn("Failed to render QR image for client %s: %v", clientID, err)
 			}
+			tasks = append(tasks, eventTask{lane: clientLane, run: func() {
+				cm.sendConnectionStatusWebhook(clientID, "qr_code", data)
+			}})
 		}
 	}
+	return tasks
 }
 
-// startTyping starts the typing indicator for a chat and sets up a 1-minute timeout
-func (cm *ClientManager) startTyping(client *WhatsAppClient, chatJID types.JID) {
+// startTyping starts the typing indicator for a chat and clears it after the given timeout
+func (cm *ClientManager) startTyping(client *WhatsAppClient, chatJID types.JID, timeout time.Duration) {
 	chatID := chatJID.String()
 
+	// Send typing indicator; the network call is made without holding the client lock
+	err := client.client.SendChatPresence(context.Background(), chatJID, types.ChatPresenceComposing, types.ChatPresenceMediaText)
+	if err != nil {
+		LogMessage.Error("Failed to send typing indicator: %v", err)
+		return
+	}
+
 	client.mutex.Lock()
 	defer client.mutex.Unlock()
 
@@ -585,18 +793,11 @@ func (cm *ClientManager) startTyping(client *WhatsAppClient, chatJID types.JID)
 		timer.Stop()
 	}
 
-	// Send typing indicator
-	err := client.client.SendChatPresence(context.Background(), chatJID, types.ChatPresenceComposing, types.ChatPresenceMediaText)
-	if err != nil {
-		LogMessage.Error("Failed to send typing indicator: %v", err)
-		return
-	}
-
 	client.typingActive[chatID] = true
 	LogMessage.Info("Started typing indicator for %s", chatID)
 
-	// Set up timer to stop typing after 1 minute
-	client.typingTimers[chatID] = time.AfterFunc(60*time.Second, func() {
+	// Set up timer to stop typing after the timeout
+	client.typingTimers[chatID] = time.AfterFunc(timeout, func() {
 		cm.stopTyping(client, chatJID)
 	})
 }
@@ -606,10 +807,9 @@ func (cm *ClientManager) stopTyping(client *WhatsAppClient, chatJID types.JID) {
 	chatID := chatJID.String()
 
 	client.mutex.Lock()
-	defer client.mutex.Unlock()
-
 	// Check if we're actually typing for this chat
 	if !client.typingActive[chatID] {
+		client.mutex.Unlock()
 		return
 	}
 
@@ -618,6 +818,8 @@ func (cm *ClientManager) stopTyping(client *WhatsAppClient, chatJID types.JID) {
 		timer.Stop()
 		delete(client.typingTimers, chatID)
 	}
+	delete(client.typingActive, chatID)
+	client.mutex.Unlock()
 
 	// Send stop typing indicator (paused)
 	err := client.client.SendChatPresence(context.Background(), chatJID, types.ChatPresencePaused, types.ChatPresenceMediaText)
@@ -626,19 +828,25 @@ func (cm *ClientManager) stopTyping(client *WhatsAppClient, chatJID types.JID) {
 	} else {
 		LogMessage.Info("Stopped typing indicator for %s", chatID)
 	}
-
-	delete(client.typingActive, chatID)
 }
 
 // Response structs
 type ClientResponse struct {
-	ID           string     `json:"id"`
-	Phone        string     `json:"phone,omitempty"`
-	IsConnected  bool       `json:"isConnected"`
-	QRCode       string     `json:"qrCode,omitempty"`
-	ConnectedAt  *time.Time `json:"connectedAt,omitempty"`
-	MessageCount int        `json:"messageCount"`
-	OSName       string     `json:"osName,omitempty"`
+	ID                string     `json:"id"`
+	Phone             string     `json:"phone,omitempty"`
+	IsConnected       bool       `json:"isConnected"`
+	State             string     `json:"state"`
+	StateReason       string     `json:"stateReason,omitempty"`
+	StateChangedAt    *time.Time `json:"stateChangedAt,omitempty"`
+	ReconnectAttempts int        `json:"reconnectAttempts,omitempty"`
+	NextReconnectAt   *time.Time `json:"nextReconnectAt,omitempty"`
+	QRCode            string     `json:"qrCode,omitempty"`
+	ConnectedAt       *time.Time `json:"connectedAt,omitempty"`
+	MessageCount      int        `json:"messageCount"`
+	OSName            string     `json:"osName,omitempty"`
+	PushName          string     `json:"pushName,omitempty"`
+	About             string     `json:"about,omitempty"`
+	PictureURL        string     `json:"pictureUrl,omitempty"`
 }
 
 type CreateClientResponse struct {
@@ -665,30 +873,35 @@ type MessageResponse struct {
 
 // Request and Response structs for sending messages
 type SendMessageRequest struct {
-	Phone   string `json:"phone" binding:"required"`
+	To      string `json:"to,omitempty"`    // Phone number or user, group, LID or newsletter JID
+	Phone   string `json:"phone,omitempty"` // Deprecated: use to
 	Message string `json:"message" binding:"required"`
 }
 
 type SendImageRequest struct {
-	Phone    string `json:"phone" binding:"required"`
+	To       string `json:"to,omitempty"`    // Phone number or user, group, LID or newsletter JID
+	Phone    string `json:"phone,omitempty"` // Deprecated: use to
 	ImageURL string `json:"imageUrl" binding:"required,url"`
 	Caption  string `json:"caption,omitempty"`
 }
 
 type SendMultipleImagesRequest struct {
-	Phone  string      `json:"phone" binding:"required"`
+	To     string      `json:"to,omitempty"`    // Phone number or user, group, LID or newsletter JID
+	Phone  string      `json:"phone,omitempty"` // Deprecated: use to
 	Images []ImageItem `json:"images" binding:"required,min=1"`
 }
 
 type SendDocumentRequest struct {
-	Phone       string `json:"phone" binding:"required"`
+	To          string `json:"to,omitempty"`    // Phone number or user, group, LID or newsletter JID
+	Phone       string `json:"phone,omitempty"` // Deprecated: use to
 	DocumentURL string `json:"documentUrl" binding:"required,url"`
 	Filename    string `json:"filename,omitempty"`
 	Caption     string `json:"caption,omitempty"`
 }
 
 type SendDocumentBase64Request struct {
-	Phone      string `json:"phone" binding:"required"`
+	To         string `json:"to,omitempty"`    // Phone number or user, group, LID or newsletter JID
+	Phone      string `json:"phone,omitempty"` // Deprecated: use to
 	Base64Data string `json:"base64Data" binding:"required"`
 	Filename   string `json:"filename" binding:"required"`
 	MimeType   string `json:"mimeType,omitempty"`
@@ -707,13 +920,16 @@ type SendMessageResponse struct {
 }
 
 type DeleteMessageRequest struct {
-	Phone     string `json:"phone" binding:"required"`
+	To        string `json:"to,omitempty"`    // Phone number or user, group, LID or newsletter JID
+	Phone     string `json:"phone,omitempty"` // Deprecated: use to
 	MessageID string `json:"messageId" binding:"required"`
 }
 
 type ProfilePictureResponse struct {
 	Phone      string `json:"phone"`
 	PictureURL string `json:"pictureUrl,omitempty"`
+	CachedURL  string `json:"cachedUrl,omitempty"`  // Stable URL served from aimeow's cache
+	PreviewURL string `json:"previewUrl,omitempty"` // Stable URL of the thumbnail
 	HasPicture bool   `json:"hasPicture"`
 	Error      string `json:"error,omitempty"`
 }
@@ -750,34 +966,7 @@ func createClient(c *gin.Context) {
 	}
 
 	// Start connection process
-	go func() {
-		qrChan, err := waClient.client.GetQRChannel(context.Background())
-		if err != nil {
-		LogQR.Error("Failed to get QR channel: %v", err)
-			return
-		}
-
-		err = waClient.client.Connect()
-		if err != nil {
-		LogClient.Error("Failed to connect client: %v", err)
-			return
-		}
-
-		for evt := range qrChan {
-			if evt.Event == "code" {
-				waClient.mutex.Lock()
-				waClient.qrCode = evt.Code
-				waClient.mutex.Unlock()
-			} else if evt.Event == "timeout" {
-				// QR code expired
-		LogQR.Info("QR code expired for client %s", clientID)
-
-				// Send webhook for timeout
-				// We need to use the clientID (UUID) here
-				go manager.sendConnectionStatusWebhook(clientID, "qr_timeout", map[string]interface{}{})
-			}
-		}
-	}()
+	go manager.startPairing(clientID, waClient)
 
 	qrURL := fmt.Sprintf("%s/qr?client_id=%s", getBaseURL(c), clientID)
 
@@ -800,22 +989,7 @@ func getAllClients(c *gin.Context) {
 	response := make([]ClientResponse, 0)
 	for id, client := range clients {
 		client.mutex.RLock()
-		resp := ClientResponse{
-			ID:           id,
-			IsConnected:  client.isConnected,
-			QRCode:       client.qrCode,
-			ConnectedAt:  client.connectedAt,
-			MessageCount: len(client.messages),
-			OSName:       client.osName,
-		}
-		// Add phone number if device is connected
-		if client.deviceStore != nil && client.deviceStore.ID != nil {
-			resp.Phone = client.deviceStore.ID.User
-		}
-		if resp.QRCode == "" {
-			resp.QRCode = "not_available"
-		}
-		response = append(response, resp)
+		response = append(response, buildClientResponse(id, client))
 		client.mutex.RUnlock()
 	}
 
@@ -871,37 +1045,46 @@ func getConfig(c *gin.Context) {
 }
 
 // @Summary Get client file
-// @Description Gets a media file for a specific client
+// @Description Gets a media file for a specific client. The link must carry a valid signature and must not have expired.
 // @Tags files
 // @Accept json
 // @Produce application/octet-stream
 // @Param client_id path string true "Client ID"
 // @Param file_id path string true "File ID"
+// @Param expires query int true "Expiry as a Unix timestamp"
+// @Param sig query string true "HMAC signature"
 // @Success 200 {file} file "Media file"
+// @Failure 403 {object} map[string]string
 // @Failure 404 {object} map[string]string
+// @Failure 410 {object} map[string]string
 // @Router /files/{client_id}/{file_id} [get]
 func getClientFile(c *gin.Context) {
 	clientID := c.Param("client_id")
 	fileID := c.Param("file_id")
 
+	if status, reason := verifyFileURL(c, clientID, fileID); status != http.StatusOK {
+		c.JSON(status, gin.H{"error": reason})
+		return
+	}
+
 	// ClientID is now a UUID, no need to sanitize
-	waClient, err := manager.getClient(clientID)
-	if err != nil {
+	if _, err := manager.getClient(clientID); err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "client not found"})
 		return
 	}
 
-	waClient.mutex.RLock()
-	filePath, exists := waClient.images[fileID]
-	waClient.mutex.RUnlock()
-
-	if !exists {
+	record, err := manager.getMedia(c.Request.Context(), clientID, fileID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if record == nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "file not found"})
 		return
 	}
 
-	// Serve the media file
-	c.File(filePath)
+	// Serve the media file under its original name
+	serveMedia(c, record)
 }
 
 // @Summary Get client by ID
@@ -923,20 +1106,7 @@ func getClient(c *gin.Context) {
 	}
 
 	waClient.mutex.RLock()
-	resp := ClientResponse{
-		ID:           clientID,
-		IsConnected:  waClient.isConnected,
-		QRCode:       waClient.qrCode,
-		ConnectedAt:  waClient.connectedAt,
-		MessageCount: len(waClient.messages),
-	}
-	// Add phone number if device is connected
-	if waClient.deviceStore != nil && waClient.deviceStore.ID != nil {
-		resp.Phone = waClient.deviceStore.ID.User
-	}
-	if resp.QRCode == "" {
-		resp.QRCode = "not_available"
-	}
+	resp := buildClientResponse(clientID, waClient)
 	waClient.mutex.RUnlock()
 
 	c.JSON(http.StatusOK, resp)
@@ -990,137 +1160,13 @@ func getQRCodeHTML(c *gin.Context) {
 		return
 	}
 
-	waClient, err := manager.getClient(clientID)
-	if err != nil {
+	if _, err := manager.getClient(clientID); err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
 		return
 	}
 
-	waClient.mutex.RLock()
-	qrCode := waClient.qrCode
-	isConnected := waClient.isConnected
-	waClient.mutex.RUnlock()
-
-	htmlContent := fmt.Sprintf(`<!DOCTYPE html>
-<html>
-<head>
-    <title>WhatsApp QR Code - Client %s</title>
-    <style>
-        body { font-family: Arial, sans-serif; text-align: center; padding: 20px; }
-        .container { max-width: 600px; margin: 0 auto; }
-        .qr-code { 
-            margin: 20px auto; 
-            padding: 20px; 
-            border: 2px solid #ddd; 
-            border-radius: 10px; 
-            background: white;
-            white-space: pre;
-            font-family: monospace;
-            line-height: 1;
-            font-size: 2px;
-        }
-        .info { 
-            margin: 20px 0; 
-            padding: 15px; 
-            background: #f0f8ff; 
-            border-radius: 5px; 
-        }
-        .refresh { 
-            margin: 10px 0; 
-        }
-        .refresh button {
-            padding: 10px 20px;
-            background: #25d366;
-            color: white;
-            border: none;
-            border-radius: 5px;
-            cursor: pointer;
-            font-size: 16px;
-        }
-        .refresh button:hover {
-            background: #128c7e;
-        }
-    </style>
-    <script>
-        function refreshQR() {
-            setTimeout(() => {
-                location.reload();
-            }, 5000);
-        }
-        
-        // Auto-refresh every 10 seconds if not connected
-        setInterval(() => {
-            fetch('/api/v1/clients/%s')
-                .then(response => response.json())
-                .then(data => {
-                    if (data.isConnected) {
-                        location.reload();
-                    }
-                })
-                .catch(() => {});
-        }, 10000);
-    </script>
-</head>
-<body>
-    <div class="container">
-        <h1>WhatsApp QR Code</h1>
-        <div class="info">
-            <strong>Client ID:</strong> %s<br>
-            <strong>Status:</strong> %s
-        </div>`, strings.ReplaceAll(clientID, "<", "&lt;"), strings.ReplaceAll(clientID, "<", "&lt;"), strings.ReplaceAll(clientID, "<", "&lt;"), map[bool]string{true: "Connected", false: "Waiting for QR scan"}[isConnected])
-
-	if isConnected {
-		htmlContent += `
-        <div class="info" style="background: #d4edda; color: #155724;">
-            <h2>✅ Connected Successfully!</h2>
-            <p>Your WhatsApp client is now connected and ready to use.</p>
-        </div>`
-	} else if qrCode == "" {
-		htmlContent += `
-        <div class="info" style="background: #fff3cd; color: #856404;">
-            <h2>⏳ Waiting for QR Code...</h2>
-            <p>QR code is being generated. Please wait.</p>
-        </div>
-        <div class="refresh">
-            <button onclick="refreshQR()">Refresh</button>
-        </div>`
-	} else {
-		// Generate QR code as ASCII art using qrterminal
-		htmlContent += `
-        <div class="info">
-            <h2>📱 Scan this QR code with WhatsApp</h2>
-            <p>Open WhatsApp on your phone → Linked Devices → Link a device</p>
-        </div>
-        <div class="refresh">
-            <button onclick="refreshQR()">Refresh QR Code</button>
-        </div>
-        <div class="qr-code">`
-
-		// Capture qrterminal output
-		var qrBuilder strings.Builder
-		qrterminal.GenerateWithConfig(qrCode, qrterminal.Config{
-			Level:     qrterminal.L,
-			Writer:    &qrBuilder,
-			BlackChar: "██",
-			WhiteChar: "  ",
-		})
-
-		// Convert to HTML-safe format
-		qrHTML := strings.ReplaceAll(qrBuilder.String(), " ", "&nbsp;")
-		qrHTML = strings.ReplaceAll(qrHTML, "\n", "<br>")
-		htmlContent += qrHTML
-
-		htmlContent += `</div>`
-	}
-
-	htmlContent += `
-        <div class="info" style="margin-top: 30px; font-size: 14px;">
-            <p>This page will automatically refresh when the connection status changes.</p>
-            <p><a href="/api/v1/clients/%s">View API details</a></p>
-        </div>
-    </div>
-</body>
-</html>`
+	// Render the pairing page; it follows QR and connection updates over server-sent events
+	htmlContent := pairingPageHTML(clientID)
 
 	c.Header("Content-Type", "text/html; charset=utf-8")
 	c.String(http.StatusOK, htmlContent)
@@ -1164,37 +1210,6 @@ func getMessages(c *gin.Context) {
 	c.JSON(http.StatusOK, response)
 }
 
-// @Summary Disconnect and delete client
-// @Description Disconnects and removes a WhatsApp client
-// @Tags clients
-// @Accept json
-// @Produce json
-// @Param id path string true "Client ID"
-// @Success 200 {object} map[string]string
-// @Failure 404 {object} map[string]string
-// @Router /clients/{id} [delete]
-func deleteClient(c *gin.Context) {
-	clientID := c.Param("id")
-
-	waClient, err := manager.getClient(clientID)
-	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
-		return
-	}
-
-	// Disconnect if connected
-	if waClient.client.IsConnected() {
-		waClient.client.Disconnect()
-	}
-
-	// Remove from manager
-	manager.mutex.Lock()
-	delete(manager.clients, clientID)
-	manager.mutex.Unlock()
-
-	c.JSON(http.StatusOK, gin.H{"message": "client deleted successfully"})
-}
-
 // @Summary Send text message
 // @Description Sends a text message to a WhatsApp number
 // @Tags messages
@@ -1227,16 +1242,9 @@ func sendMessage(c *gin.Context) {
 		return
 	}
 
-	// Format phone number (remove @s.whatsapp.net if present, add if missing)
-	targetJID := strings.TrimSuffix(req.Phone, "@s.whatsapp.net")
-	if !strings.Contains(targetJID, "@") {
-		targetJID += "@s.whatsapp.net"
-	}
-
-	// Parse JID
-	targetJIDParsed, err := types.ParseJID(targetJID)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid phone number format: %v", err)})
+	// Resolve the recipient from "to", falling back to the legacy "phone"
+	targetJIDParsed, ok := bindRecipient(c, clientID, req.To, req.Phone)
+	if !ok {
 		return
 	}
 
@@ -1295,21 +1303,14 @@ func sendImage(c *gin.Context) {
 		return
 	}
 
-	// Format phone number
-	targetJID := strings.TrimSuffix(req.Phone, "@s.whatsapp.net")
-	if !strings.Contains(targetJID, "@") {
-		targetJID += "@s.whatsapp.net"
-	}
-
-	// Parse JID
-	targetJIDParsed, err := types.ParseJID(targetJID)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid phone number format: %v", err)})
+	// Resolve the recipient from "to", falling back to the legacy "phone"
+	targetJIDParsed, ok := bindRecipient(c, clientID, req.To, req.Phone)
+	if !ok {
 		return
 	}
 
 	// Download image from URL
-	resp, err := http.Get(req.ImageURL)
+	fetched, err := mediaFetcher.fetch(c.Request.Context(), req.ImageURL)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, SendMessageResponse{
 			Success: false,
@@ -1317,25 +1318,7 @@ func sendImage(c *gin.Context) {
 		})
 		return
 	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		c.JSON(http.StatusBadRequest, SendMessageResponse{
-			Success: false,
-			Error:   fmt.Sprintf("Image download failed with status: %d", resp.StatusCode),
-		})
-		return
-	}
-
-	// Read image data
-	imageData, err := io.ReadAll(resp.Body)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, SendMessageResponse{
-			Success: false,
-			Error:   fmt.Sprintf("Failed to read image data: %v", err),
-		})
-		return
-	}
+	imageData := fetched.Data
 
 	// Upload image to WhatsApp
 	uploaded, err := waClient.client.Upload(context.Background(), imageData, whatsmeow.MediaImage)
@@ -1351,7 +1334,7 @@ func sendImage(c *gin.Context) {
 	imageMsg := &waE2E.Message{
 		ImageMessage: &waE2E.ImageMessage{
 			URL:           proto.String(uploaded.URL),
-			Mimetype:      proto.String(resp.Header.Get("Content-Type")),
+			Mimetype:      proto.String(fetched.ContentType),
 			Caption:       proto.String(req.Caption),
 			FileLength:    proto.Uint64(uint64(len(imageData))),
 			FileSHA256:    uploaded.FileSHA256,
@@ -1412,16 +1395,9 @@ func sendMultipleImages(c *gin.Context) {
 		return
 	}
 
-	// Format phone number
-	targetJID := strings.TrimSuffix(req.Phone, "@s.whatsapp.net")
-	if !strings.Contains(targetJID, "@") {
-		targetJID += "@s.whatsapp.net"
-	}
-
-	// Parse JID
-	targetJIDParsed, err := types.ParseJID(targetJID)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid phone number format: %v", err)})
+	// Resolve the recipient from "to", falling back to the legacy "phone"
+	targetJIDParsed, ok := bindRecipient(c, clientID, req.To, req.Phone)
+	if !ok {
 		return
 	}
 
@@ -1434,24 +1410,12 @@ func sendMultipleImages(c *gin.Context) {
 	// Send each image
 	for i, imageItem := range req.Images {
 		// Download image from URL
-		resp, err := http.Get(imageItem.ImageURL)
+		fetched, err := mediaFetcher.fetch(c.Request.Context(), imageItem.ImageURL)
 		if err != nil {
 			errors = append(errors, fmt.Sprintf("Image %d: Failed to download - %v", i+1, err))
 			continue
 		}
-		defer resp.Body.Close()
-
-		if resp.StatusCode != http.StatusOK {
-			errors = append(errors, fmt.Sprintf("Image %d: Download failed with status %d", i+1, resp.StatusCode))
-			continue
-		}
-
-		// Read image data
-		imageData, err := io.ReadAll(resp.Body)
-		if err != nil {
-			errors = append(errors, fmt.Sprintf("Image %d: Failed to read data - %v", i+1, err))
-			continue
-		}
+		imageData := fetched.Data
 
 		// Upload image to WhatsApp
 		uploaded, err := waClient.client.Upload(context.Background(), imageData, whatsmeow.MediaImage)
@@ -1464,7 +1428,7 @@ func sendMultipleImages(c *gin.Context) {
 		imageMsg := &waE2E.Message{
 			ImageMessage: &waE2E.ImageMessage{
 				URL:           proto.String(uploaded.URL),
-				Mimetype:      proto.String(resp.Header.Get("Content-Type")),
+				Mimetype:      proto.String(fetched.ContentType),
 				Caption:       proto.String(imageItem.Caption),
 				FileLength:    proto.Uint64(uint64(len(imageData))),
 				FileSHA256:    uploaded.FileSHA256,
@@ -1536,21 +1500,14 @@ func sendDocument(c *gin.Context) {
 		return
 	}
 
-	// Format phone number
-	targetJID := strings.TrimSuffix(req.Phone, "@s.whatsapp.net")
-	if !strings.Contains(targetJID, "@") {
-		targetJID += "@s.whatsapp.net"
-	}
-
-	// Parse JID
-	targetJIDParsed, err := types.ParseJID(targetJID)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid phone number format: %v", err)})
+	// Resolve the recipient from "to", falling back to the legacy "phone"
+	targetJIDParsed, ok := bindRecipient(c, clientID, req.To, req.Phone)
+	if !ok {
 		return
 	}
 
 	// Download document from URL
-	resp, err := http.Get(req.DocumentURL)
+	fetched, err := mediaFetcher.fetch(c.Request.Context(), req.DocumentURL)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, SendMessageResponse{
 			Success: false,
@@ -1558,28 +1515,10 @@ func sendDocument(c *gin.Context) {
 		})
 		return
 	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		c.JSON(http.StatusBadRequest, SendMessageResponse{
-			Success: false,
-			Error:   fmt.Sprintf("Document download failed with status: %d", resp.StatusCode),
-		})
-		return
-	}
-
-	// Read document data
-	documentData, err := io.ReadAll(resp.Body)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, SendMessageResponse{
-			Success: false,
-			Error:   fmt.Sprintf("Failed to read document data: %v", err),
-		})
-		return
-	}
+	documentData := fetched.Data
 
 	// Get content type and filename
-	contentType := resp.Header.Get("Content-Type")
+	contentType := fetched.ContentType
 	if contentType == "" {
 		contentType = "application/octet-stream"
 	}
@@ -1689,16 +1628,9 @@ func sendDocumentBase64(c *gin.Context) {
 
 	LogBase64.Debug("Decoded %d bytes from base64 input", len(documentData))
 
-	// Format phone number
-	targetJID := strings.TrimSuffix(req.Phone, "@s.whatsapp.net")
-	if !strings.Contains(targetJID, "@") {
-		targetJID += "@s.whatsapp.net"
-	}
-
-	// Parse JID
-	targetJIDParsed, err := types.ParseJID(targetJID)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid phone number format: %v", err)})
+	// Resolve the recipient from "to", falling back to the legacy "phone"
+	targetJIDParsed, ok := bindRecipient(c, clientID, req.To, req.Phone)
+	if !ok {
 		return
 	}
 
@@ -1746,7 +1678,7 @@ func sendDocumentBase64(c *gin.Context) {
 		return
 	}
 
-	LogBase64.Info("Successfully sent document %s (%d bytes) to %s", req.Filename, len(documentData), req.Phone)
+	LogBase64.Info("Successfully sent document %s (%d bytes) to %s", req.Filename, len(documentData), targetJIDParsed.String())
 
 	c.JSON(http.StatusOK, SendMessageResponse{
 		Success:   true,
@@ -1786,16 +1718,9 @@ func deleteMessage(c *gin.Context) {
 		return
 	}
 
-	// Format phone number (remove @s.whatsapp.net if present, add if missing)
-	targetJID := strings.TrimSuffix(req.Phone, "@s.whatsapp.net")
-	if !strings.Contains(targetJID, "@") {
-		targetJID += "@s.whatsapp.net"
-	}
-
-	// Parse JID
-	targetJIDParsed, err := types.ParseJID(targetJID)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid phone number format: %v", err)})
+	// Resolve the recipient from "to", falling back to the legacy "phone"
+	targetJIDParsed, ok := bindRecipient(c, clientID, req.To, req.Phone)
+	if !ok {
 		return
 	}
 
@@ -1810,7 +1735,7 @@ func deleteMessage(c *gin.Context) {
 		return
 	}
 
-	LogMessage.Info("Message %s deleted from chat %s (revoke ID: %s)", req.MessageID, targetJID, resp.ID)
+	LogMessage.Info("Message %s deleted from chat %s (revoke ID: %s)", req.MessageID, targetJIDParsed, resp.ID)
 
 	c.JSON(http.StatusOK, SendMessageResponse{
 		Success:   true,
@@ -1848,19 +1773,12 @@ func getProfilePicture(c *gin.Context) {
 		return
 	}
 
-	// Format phone number
-	targetJID := strings.TrimSuffix(phone, "@s.whatsapp.net")
-	if !strings.Contains(targetJID, "@") {
-		targetJID += "@s.whatsapp.net"
-	}
-
-	// Parse JID
-	targetJIDParsed, err := types.ParseJID(targetJID)
+	targetJIDParsed, err := manager.resolveRecipientFor(clientID, phone)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, ProfilePictureResponse{
 			Phone:      phone,
 			HasPicture: false,
-			Error:      fmt.Sprintf("Invalid phone number format: %v", err),
+			Error:      err.Error(),
 		})
 		return
 	}
@@ -1900,6 +1818,8 @@ func getProfilePicture(c *gin.Context) {
 	c.JSON(http.StatusOK, ProfilePictureResponse{
 		Phone:      phone,
 		PictureURL: pictureInfo.URL,
+		CachedURL:  avatarURL(clientID, targetJIDParsed, AvatarSizeFull),
+		PreviewURL: avatarURL(clientID, targetJIDParsed, AvatarSizePreview),
 		HasPicture: true,
 	})
 }
@@ -1968,127 +1888,126 @@ func checkWhatsApp(c *gin.Context) {
 	})
 }
 
-func (cm *ClientManager) sendWebhook(client *WhatsAppClient, message interface{}) {
-	if cm.callbackURL == "" {
-		return
-	}
+// webhookClient bounds how long a slow backend can hold up a chat's event queue
+var webhookClient = &http.Client{Timeout: 30 * time.Second}
 
-	// Extract message data from the message interface
-	webhookData := cm.extractMessageData(client, message)
-
-	jsonData, err := json.Marshal(webhookData)
+// postWebhook sends a JSON webhook; the Idempotency-Key header repeats the key in the body
+func postWebhook(target webhookTarget, idempotencyKey string, body []byte) (int, error) {
+	req, err := http.NewRequest(http.MethodPost, target.url, bytes.NewReader(body))
 	if err != nil {
-		LogWebhook.Error("Failed to marshal webhook data: %v", err)
-		return
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Idempotency-Key", idempotencyKey)
+	if target.secret != "" {
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		req.Header.Set("X-Aimeow-Timestamp", timestamp)
+		req.Header.Set("X-Aimeow-Signature", webhookSignature(target.secret, timestamp, body))
 	}
 
-	// Log the webhook payload for debugging
-	LogWebhook.Debug("Payload: %s", string(jsonData))
-
-	resp, err := http.Post(cm.callbackURL, "application/json", bytes.NewBuffer(jsonData))
+	resp, err := webhookClient.Do(req)
 	if err != nil {
-		LogWebhook.Error("Failed to send webhook: %v", err)
-		return
+		return 0, err
 	}
 	defer resp.Body.Close()
-
-	if resp.StatusCode >= 400 {
-		LogWebhook.Warn("Webhook returned error status: %d", resp.StatusCode)
-	} else {
-		LogWebhook.Info("Successfully sent to %s (status: %d)", cm.callbackURL, resp.StatusCode)
-	}
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	return resp.StatusCode, nil
 }
 
-// sendConnectionStatusWebhook sends connection status updates to the backend
-func (cm *ClientManager) sendConnectionStatusWebhook(clientID string, event string, data map[string]interface{}) {
-	if cm.callbackURL == "" {
-		return
-	}
-
-	// Construct status webhook URL by appending /status to the callback URL
-	statusURL := cm.callbackURL
-	if !strings.HasSuffix(statusURL, "/") {
-		statusURL += "/"
-	}
-	statusURL += "status"
-
-	webhookData := map[string]interface{}{
-		"clientId":  clientID,
-		"event":     event,
-		"data":      data,
-		"timestamp": time.Now().Unix(),
+func (cm *ClientManager) sendWebhook(client *WhatsAppClient, message interface{}) {
+	// Extract message data from the message interface
+	webhookData := cm.extractMessageData(client, message)
+	clientID := webhookData.ClientID
+
+	// Each message is delivered once, however many times whatsmeow hands it to us
+	var deliveryKey string
+	idempotencyKey := uuid.NewString()
+	if msg, ok := message.(*events.Message); ok {
+		deliveryKey = messageDeliveryKey(msg)
+		if claimed, err := cm.claimDelivery(context.Background(), clientID, deliveryKey, msg.Info.ID, "message"); err != nil {
+			LogDatabase.Warn("%v", err)
+		} else if !claimed {
+			LogWebhook.Debug("Message %s was already delivered, not sending it again", msg.Info.ID)
+			return
+		}
+		idempotencyKey = webhookIdempotencyKey(clientID, "message", deliveryKey)
 	}
+	webhookData.IdempotencyKey = idempotencyKey
+	cm.appendEventLog(clientID, messageWebhookEvent, idempotencyKey, webhookData)
 
-	jsonData, err := json.Marshal(webhookData)
-	if err != nil {
-		LogWebhook.Error("Failed to marshal status webhook data: %v", err)
+	targets := cm.webhookTargets(clientID, messageWebhookEvent)
+	if len(targets) == 0 {
 		return
 	}
 
-	LogWebhook.Debug("Event: %s, Client: %s, Payload: %s", event, clientID, string(jsonData))
-
-	resp, err := http.Post(statusURL, "application/json", bytes.NewBuffer(jsonData))
+	jsonData, err := encodeWebhook(messageWebhookEvent, webhookData, cm.webhookSchemaFor(clientID))
 	if err != nil {
-		LogWebhook.Error("Failed to send status webhook: %v", err)
+		LogWebhook.Error("Failed to marshal webhook data: %v", err)
 		return
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode >= 400 {
-		LogWebhook.Warn("Status webhook returned error status: %d", resp.StatusCode)
-	} else {
-		LogWebhook.Info("Successfully sent to %s (status: %d)", statusURL, resp.StatusCode)
+	// Log the webhook payload for debugging
+	LogWebhook.Debug("Payload: %s", string(jsonData))
+
+	// A receiver that is down may accept a redelivery of the message once it recovers;
+	// the others recognize it by its idempotency key
+	if failed := cm.deliverWebhook(targets, messageWebhookEvent, idempotencyKey, jsonData); failed && deliveryKey != "" {
+		cm.releaseDelivery(context.Background(), clientID, deliveryKey)
 	}
 }
 
-func (cm *ClientManager) downloadImage(client *WhatsAppClient, message interface{}) {
-	// Type assert to get the actual message struct
-	msg, ok := message.(*events.Message)
-	if !ok {
-		return
+// sendConnectionStatusWebhook sends connection status updates to the backend
+// data is one of the event's typed payloads, see webhookEvents
+func (cm *ClientManager) sendConnectionStatusWebhook(clientID string, event string, data interface{}) {
+	// Events about a message get the same key every time; others are unique per send
+	idempotencyKey := uuid.NewString()
+	if msgEvent, ok := data.(messageEvent); ok && msgEvent.eventMessageID() != "" {
+		idempotencyKey = webhookIdempotencyKey(clientID, event, msgEvent.eventMessageID())
 	}
 
-	// Check if message contains media
-	if msg.Message.GetImageMessage() == nil && msg.Message.GetVideoMessage() == nil && msg.Message.GetAudioMessage() == nil && msg.Message.GetDocumentMessage() == nil {
-		LogMedia.Debug("No media in message, skipping download")
-		return
+	webhookData := StatusWebhook{
+		SchemaVersion:  WebhookSchemaVersion,
+		Event:          event,
+		ClientID:       clientID,
+		IdempotencyKey: idempotencyKey,
+		Timestamp:      time.Now().Unix(),
+		Data:           data,
 	}
+	cm.appendEventLog(clientID, event, idempotencyKey, webhookData)
 
-	LogMedia.Debug("Media detected in message, proceeding with download")
-
-	// Get the UUID for this client
-	whatsappID := client.deviceStore.ID.String()
-	if whatsappID == "" {
+	targets := cm.webhookTargets(clientID, event)
+	if len(targets) == 0 {
 		return
 	}
 
-	cm.mutex.RLock()
-	clientID, exists := cm.clientIDMap[whatsappID]
-	cm.mutex.RUnlock()
-
-	// Fallback to WhatsApp ID if mapping doesn't exist
-	if !exists {
-		clientID = whatsappID
-		LogClient.Warn("No UUID mapping found for client %s", whatsappID)
-	}
-
-	// Create client directory using UUID (no need to sanitize since UUIDs don't have special chars)
-	clientDir := filepath.Join(dataDir, "files", clientID)
-	err := os.MkdirAll(clientDir, 0755)
+	jsonData, err := encodeWebhook(event, webhookData, cm.webhookSchemaFor(clientID))
 	if err != nil {
-		LogClient.Error("Failed to create client directory: %v", err)
+		LogWebhook.Error("Failed to marshal status webhook data: %v", err)
 		return
 	}
 
+	LogWebhook.Debug("Event: %s, Client: %s, Payload: %s", event, clientID, string(jsonData))
+
+	cm.deliverWebhook(targets, event, idempotencyKey, jsonData)
+}
+
+// downloadImage streams a message's media to a temporary file and stores it in the configured backend
+func (cm *ClientManager) downloadImage(ctx context.Context, client *WhatsAppClient, clientID string, msg *events.Message) (*MediaRecord, error) {
+	var media whatsmeow.DownloadableMessage
 	var fileExtension string
 	var mediaType string
-	var mediaData []byte
+	var mimeType string
+	var fileName string
+	var fileLength uint64
 
-	// Handle different media types using whatsmeow Download (handles decryption)
+	// Handle different media types; whatsmeow handles decryption
 	switch {
 	case msg.Message.GetImageMessage() != nil:
 		imageMsg := msg.Message.GetImageMessage()
+		media = imageMsg
 		mediaType = "image"
+		mimeType = imageMsg.GetMimetype()
+		fileLength = imageMsg.GetFileLength()
 		fileExtension = ".jpg"
 		if imageMsg.GetMimetype() == "image/png" {
 			fileExtension = ".png"
@@ -2097,81 +2016,128 @@ func (cm *ClientManager) downloadImage(client *WhatsAppClient, message interface
 		} else if imageMsg.GetMimetype() == "image/gif" {
 			fileExtension = ".gif"
 		}
-		// Use whatsmeow Download to properly decrypt media
-		mediaData, err = client.client.Download(context.Background(), imageMsg)
-		if err != nil {
-			LogMedia.Error("Failed to download image for client %s: %v", clientID, err)
-			return
-		}
 
 	case msg.Message.GetVideoMessage() != nil:
 		videoMsg := msg.Message.GetVideoMessage()
+		media = videoMsg
 		mediaType = "video"
+		mimeType = videoMsg.GetMimetype()
+		fileLength = videoMsg.GetFileLength()
 		fileExtension = ".mp4"
 		if videoMsg.GetMimetype() == "video/3gpp" {
 			fileExtension = ".3gp"
 		} else if videoMsg.GetMimetype() == "video/webm" {
 			fileExtension = ".webm"
 		}
-		mediaData, err = client.client.Download(context.Background(), videoMsg)
-		if err != nil {
-			LogMedia.Error("Failed to download video for client %s: %v", clientID, err)
-			return
-		}
 
 	case msg.Message.GetAudioMessage() != nil:
 		audioMsg := msg.Message.GetAudioMessage()
+		media = audioMsg
 		mediaType = "audio"
+		mimeType = audioMsg.GetMimetype()
+		fileLength = audioMsg.GetFileLength()
 		fileExtension = ".ogg"
 		if audioMsg.GetMimetype() == "audio/mpeg" {
 			fileExtension = ".mp3"
 		} else if audioMsg.GetMimetype() == "audio/mp4" {
 			fileExtension = ".m4a"
 		}
-		mediaData, err = client.client.Download(context.Background(), audioMsg)
-		if err != nil {
-			LogMedia.Error("Failed to download audio for client %s: %v", clientID, err)
-			return
-		}
 
 	case msg.Message.GetDocumentMessage() != nil:
 		docMsg := msg.Message.GetDocumentMessage()
+		media = docMsg
 		mediaType = "document"
-		fileName := docMsg.GetFileName()
+		mimeType = docMsg.GetMimetype()
+		fileLength = docMsg.GetFileLength()
+		fileName = docMsg.GetFileName()
 		if ext := filepath.Ext(fileName); ext != "" {
 			fileExtension = ext
 		} else {
 			fileExtension = ".bin"
 		}
-		mediaData, err = client.client.Download(context.Background(), docMsg)
-		if err != nil {
-			LogMedia.Error("Failed to download document for client %s: %v", clientID, err)
-			return
-		}
 
 	default:
-		return
+		return nil, errNoMedia
 	}
 
-	mediaID := msg.Info.ID
-	mediaPath := filepath.Join(clientDir, mediaID+fileExtension)
+	// Refuse oversized files before fetching anything
+	maxSize := cm.getClientSettings(clientID).MediaMaxFileBytes[mediaType]
+	if maxSize > 0 && fileLength > uint64(maxSize) {
+		return nil, fmt.Errorf("%w: %s of %d bytes exceeds the limit of %d", errMediaTooLarge, mediaType, fileLength, maxSize)
+	}
 
-	// Save decrypted media to file
-	err = os.WriteFile(mediaPath, mediaData, 0644)
+	tmpDir := filepath.Join(dataDir, "tmp")
+	if err := os.MkdirAll(tmpDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create temp directory: %w", err)
+	}
+	tmpFile, err := os.CreateTemp(tmpDir, "media-*")
 	if err != nil {
-		LogMedia.Error("Failed to save %s file for client %s: %v", mediaType, clientID, err)
-		return
+		return nil, fmt.Errorf("failed to create temp file: %w", err)
 	}
+	defer os.Remove(tmpFile.Name())
+	defer tmpFile.Close()
 
-	// Store media path in client
-	client.mutex.Lock()
-	client.images[mediaID] = mediaPath
-	client.mutex.Unlock()
+	// Stream the decrypted media to disk instead of holding it in memory
+	if err := client.client.DownloadToFile(ctx, media, tmpFile); err != nil {
+		return nil, fmt.Errorf("failed to download %s: %w", mediaType, err)
+	}
+
+	if _, err := tmpFile.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	hash := sha256.New()
+	size, err := io.Copy(hash, tmpFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to hash %s: %w", mediaType, err)
+	}
+	if maxSize > 0 && size > maxSize {
+		return nil, fmt.Errorf("%w: %s of %d bytes exceeds the limit of %d", errMediaTooLarge, mediaType, size, maxSize)
+	}
+	if _, err := tmpFile.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	mediaID := msg.Info.ID
+	mediaKey := clientID + "/" + mediaID + fileExtension
 
-	LogMedia.Info("%s downloaded for client %s: %s -> %s (%d bytes)", strings.Title(mediaType), clientID, mediaID, mediaPath, len(mediaData))
+	if mimeType == "" {
+		mimeType = mime.TypeByExtension(fileExtension)
+	}
+	if mimeType == "" {
+		mimeType = "application/octet-stream"
+	}
+
+	// Save decrypted media to the configured storage backend
+	if err := mediaStorage.Put(ctx, mediaKey, tmpFile, size, mimeType); err != nil {
+		return nil, fmt.Errorf("failed to save %s file: %w", mediaType, err)
+	}
+
+	// Index the file so its URL keeps working after a restart
+	if fileName == "" {
+		fileName = mediaID + fileExtension
+	}
+	record := MediaRecord{
+		ClientID:  clientID,
+		MessageID: mediaID,
+		Chat:      msg.Info.Chat.String(),
+		MediaType: mediaType,
+		Backend:   mediaStorage.Name(),
+		Path:      mediaKey,
+		MimeType:  mimeType,
+		FileName:  fileName,
+		Size:      size,
+		SHA256:    hex.EncodeToString(hash.Sum(nil)),
+		CreatedAt: time.Now(),
+	}
+	if err := cm.saveMedia(ctx, record); err != nil {
+		return nil, fmt.Errorf("failed to index %s file: %w", mediaType, err)
+	}
+
+	LogMedia.Info("%s downloaded for client %s: %s -> %s:%s (%d bytes)", strings.Title(mediaType), clientID, mediaID, record.Backend, mediaKey, size)
+	return &record, nil
 }
 
-func (cm *ClientManager) extractMessageData(client *WhatsAppClient, message interface{}) map[string]interface{} {
+func (cm *ClientManager) extractMessageData(client *WhatsAppClient, message interface{}) MessageWebhook {
 	// Get the UUID for this client by looking up the WhatsApp ID in our mapping
 	whatsappID := client.deviceStore.ID.String()
 	cm.mutex.RLock()
@@ -2187,163 +2153,45 @@ func (cm *ClientManager) extractMessageData(client *WhatsAppClient, message inte
 	// Type assert to get actual message struct
 	msg, ok := message.(*events.Message)
 	if !ok {
-		return map[string]interface{}{
-			"clientId": clientID,
-			"message": map[string]interface{}{
-				"type": "unknown",
-			},
-			"timestamp": time.Now().Unix(),
-		}
-	}
-
-	// Extract sender - prioritize actual phone number for LID contacts
-	// For LID (Lidded Identity) contacts, SenderAlt contains the actual phone number
-	// while Chat.User and Sender.User contain the LID identifier
-	var fromUser string
-
-	// First try to get the actual phone number from SenderAlt
-	if msg.Info.SenderAlt.User != "" {
-		// SenderAlt contains the actual phone number for LID contacts
-		fromUser = msg.Info.SenderAlt.User
-	} else {
-		// SenderAlt is empty, try to lookup LID using whatsmeow's GetUserInfo
-		var potentialLIDs []types.JID
-
-		// Helper to check if a number looks like a LID (not a real phone)
-		isLIDNumber := func(num string) bool {
-			if len(num) < 14 {
-				return false
-			}
-			// Known LID patterns
-			if strings.HasPrefix(num, "100") || strings.HasPrefix(num, "101") || strings.HasPrefix(num, "102") {
-				return true
-			}
-			// Too long for any real phone number
-			if len(num) >= 16 {
-				return true
-			}
-			// Country-specific checks
-			if strings.HasPrefix(num, "1") && len(num) > 11 {
-				return true // US/Canada max 11 digits
-			}
-			if strings.HasPrefix(num, "62") && len(num) > 14 {
-				return true // Indonesia max 14 digits
-			}
-			return false
-		}
-
-		// Collect potential LID JIDs - check both @lid suffix AND suspicious number patterns
-		if strings.Contains(msg.Info.Chat.String(), "@lid") {
-			potentialLIDs = append(potentialLIDs, msg.Info.Chat)
-		} else if isLIDNumber(msg.Info.Chat.User) {
-			// Number looks like LID even without @lid suffix
-			potentialLIDs = append(potentialLIDs, msg.Info.Chat)
-		LogLID.Debug("Chat %s looks like LID based on number pattern", msg.Info.Chat.String())
-		}
-		if strings.Contains(msg.Info.Sender.String(), "@lid") && msg.Info.Sender.String() != msg.Info.Chat.String() {
-			potentialLIDs = append(potentialLIDs, msg.Info.Sender)
-		} else if isLIDNumber(msg.Info.Sender.User) && msg.Info.Sender.String() != msg.Info.Chat.String() {
-			potentialLIDs = append(potentialLIDs, msg.Info.Sender)
-		LogLID.Debug("Sender %s looks like LID based on number pattern", msg.Info.Sender.String())
-		}
-
-		// Try to resolve LID to phone number using device store
-		// The device store should have persistent LID to phone number mappings
-		if len(potentialLIDs) > 0 {
-			for _, lidJID := range potentialLIDs {
-				// Method 1: Check if device store has this LID mapped using GetAltJID
-				if altJID, err := client.deviceStore.GetAltJID(context.Background(), lidJID); err == nil && altJID.User != "" {
-					fromUser = altJID.User
-		LogLID.Debug("Found phone via DeviceStore.GetAltJID: %s -> %s", lidJID.String(), altJID.String())
-					break
-				}
-
-				// Method 2: Try ResolveContactQRLink to get contact info
-				if contactInfo, err := client.client.ResolveContactQRLink(context.Background(), lidJID.User); err == nil && contactInfo.JID.User != "" {
-					// Check if resolved JID is a phone number (not LID)
-					if !strings.Contains(contactInfo.JID.String(), "@lid") {
-						fromUser = contactInfo.JID.User
-		LogLID.Debug("Found phone via ResolveContactQRLink: %s -> %s", lidJID.String(), fromUser)
-						// Store the mapping for future use
-						client.client.StoreLIDPNMapping(context.Background(), lidJID, contactInfo.JID)
-						break
-					}
-				}
-
-				// Method 3: Try GetUserInfo as fallback
-				userInfoMap, err := client.client.GetUserInfo(context.Background(), []types.JID{lidJID})
-				if err == nil {
-					if userInfo, exists := userInfoMap[lidJID]; exists {
-						// Check if VerifiedName has phone info or try to get from other fields
-							LogLID.Debug("GetUserInfo result for %s: LID=%s, VerifiedName=%+v",
-							lidJID.String(), userInfo.LID.String(), userInfo.VerifiedName)
-						if userInfo.LID.User != "" && userInfo.LID.User != lidJID.User && !strings.Contains(userInfo.LID.String(), "@lid") {
-							fromUser = userInfo.LID.User
-						LogLID.Debug("Found phone via GetUserInfo.LID: %s -> %s", lidJID.String(), fromUser)
-							break
-						}
-					}
-				}
-			}
-		}
-
-		// If still no phone number, fall back to original logic
-		if fromUser == "" {
-			if msg.Info.Chat.Server == types.DefaultUserServer {
-				// Individual chat - use Chat.User (the actual phone number or LID)
-				fromUser = msg.Info.Chat.User
-			} else if msg.Info.Chat.Server == types.GroupServer {
-				// Group chat - use Sender.User to identify who sent the message
-				fromUser = msg.Info.Sender.User
-			} else {
-				// For other cases (e.g., status@broadcast) - use Sender.User
-				fromUser = msg.Info.Sender.User
-			}
+		return MessageWebhook{
+			SchemaVersion: WebhookSchemaVersion,
+			Event:         messageWebhookEvent,
+			ClientID:      clientID,
+			Timestamp:     time.Now().Unix(),
+			Message:       MessagePayload{Type: "unknown"},
 		}
 	}
 
-	// Check if fromUser looks like an LID (not a valid phone number)
-	// LIDs are typically 14+ digit numbers that don't match phone patterns
-	isUnresolvedLID := false
-	if len(fromUser) >= 14 {
-		// Check if it starts with known LID patterns or is too long for any country
-		if strings.HasPrefix(fromUser, "100") || strings.HasPrefix(fromUser, "101") ||
-			strings.HasPrefix(fromUser, "102") || len(fromUser) >= 16 {
-			isUnresolvedLID = true
-		}
-		// Also check country-specific max lengths
-		if strings.HasPrefix(fromUser, "1") && len(fromUser) > 11 { // US/Canada max 11
-			isUnresolvedLID = true
-		}
-		if strings.HasPrefix(fromUser, "62") && len(fromUser) > 14 { // Indonesia max 14
-			isUnresolvedLID = true
-		}
+	// "from" is the sender's phone number when it's known, otherwise the LID or group member as-is
+	resolution := cm.resolveMessageSender(context.Background(), client, clientID, msg.Info)
+	fromUser := resolution.Phone
+	if fromUser == "" {
+		jid, _ := types.ParseJID(resolution.JID)
+		fromUser = jid.User
 	}
 
-	// Debug logging to help diagnose issues
-	LogWebhook.Debug("Message from Chat=%s Sender=%s SenderAlt=%s Using=%s IsLID=%v",
-		msg.Info.Chat.String(), msg.Info.Sender.String(), msg.Info.SenderAlt.String(), fromUser, isUnresolvedLID)
+	LogWebhook.Debug("Message from Chat=%s Sender=%s SenderAlt=%s Using=%s Resolution=%s/%s",
+		msg.Info.Chat.String(), msg.Info.Sender.String(), msg.Info.SenderAlt.String(), fromUser, resolution.Status, resolution.Source)
 
-	messageData := map[string]interface{}{
-		"id":        msg.Info.ID,
-		"from":      fromUser,
-		"timestamp": msg.Info.Timestamp,
-		"pushName":  msg.Info.PushName,
-		"fromMe":    msg.Info.IsFromMe,
+	messageData := MessagePayload{
+		ID:        msg.Info.ID,
+		From:      fromUser,
+		Timestamp: msg.Info.Timestamp.Unix(),
+		PushName:  msg.Info.PushName,
+		FromMe:    msg.Info.IsFromMe,
 	}
 
 	// ALWAYS include raw JID info for reliable reply targeting
 	// The backend can use rawChat (for DM) or rawSender (for Groups) to determine reply destination
-	messageData["rawChat"] = msg.Info.Chat.String()
-	messageData["rawSender"] = msg.Info.Sender.String()
+	messageData.RawChat = msg.Info.Chat.String()
+	messageData.RawSender = msg.Info.Sender.String()
 	if msg.Info.SenderAlt.User != "" {
-		messageData["rawSenderAlt"] = msg.Info.SenderAlt.String()
+		messageData.RawSenderAlt = msg.Info.SenderAlt.String()
 	}
 
-	// Flag unresolved LID for additional handling
-	if isUnresolvedLID {
-		messageData["isLID"] = true
-	LogWebhook.Warn("Unresolved LID detected: %s - SenderAlt was: %s", fromUser, msg.Info.SenderAlt.String())
+	messageData.Resolution = resolution
+	if resolution.Status == ResolutionUnresolved {
+		LogWebhook.Warn("Unresolved LID: %s - SenderAlt was: %s", resolution.JID, msg.Info.SenderAlt.String())
 	}
 
 	// Determine message type and extract content
@@ -2352,14 +2200,14 @@ func (cm *ClientManager) extractMessageData(client *WhatsAppClient, message inte
 	switch {
 	case msg.Message.GetConversation() != "":
 		// Text message
-		messageData["type"] = "text"
-		messageData["text"] = msg.Message.GetConversation()
+		messageData.Type = "text"
+		messageData.Text = msg.Message.GetConversation()
 
 	case msg.Message.GetExtendedTextMessage() != nil:
 		// Extended text message (reply, mention, etc.)
 		extMsg := msg.Message.GetExtendedTextMessage()
-		messageData["type"] = "text"
-		messageData["text"] = extMsg.GetText()
+		messageData.Type = "text"
+		messageData.Text = extMsg.GetText()
 
 		// Extract mentions
 		if extMsg.ContextInfo != nil {
@@ -2371,13 +2219,13 @@ func (cm *ClientManager) extractMessageData(client *WhatsAppClient, message inte
 	case msg.Message.GetImageMessage() != nil:
 		// Image message
 		imgMsg := msg.Message.GetImageMessage()
-		messageData["type"] = "image"
-		messageData["caption"] = imgMsg.GetCaption()
-		messageData["mimeType"] = imgMsg.GetMimetype()
-		messageData["width"] = imgMsg.GetWidth()
-		messageData["height"] = imgMsg.GetHeight()
+		messageData.Type = "image"
+		messageData.Caption = imgMsg.GetCaption()
+		messageData.MimeType = imgMsg.GetMimetype()
+		messageData.Width = imgMsg.GetWidth()
+		messageData.Height = imgMsg.GetHeight()
 		if imgMsg.GetFileLength() > 0 {
-			messageData["fileSize"] = imgMsg.GetFileLength()
+			messageData.FileSize = imgMsg.GetFileLength()
 		}
 
 		// Extract mentions
@@ -2390,11 +2238,11 @@ func (cm *ClientManager) extractMessageData(client *WhatsAppClient, message inte
 	case msg.Message.GetVideoMessage() != nil:
 		// Video message
 		vidMsg := msg.Message.GetVideoMessage()
-		messageData["type"] = "video"
-		messageData["caption"] = vidMsg.GetCaption()
-		messageData["mimeType"] = vidMsg.GetMimetype()
+		messageData.Type = "video"
+		messageData.Caption = vidMsg.GetCaption()
+		messageData.MimeType = vidMsg.GetMimetype()
 		if vidMsg.GetFileLength() > 0 {
-			messageData["fileSize"] = vidMsg.GetFileLength()
+			messageData.FileSize = vidMsg.GetFileLength()
 		}
 
 		// Extract mentions
@@ -2407,13 +2255,13 @@ func (cm *ClientManager) extractMessageData(client *WhatsAppClient, message inte
 	case msg.Message.GetLiveLocationMessage() != nil:
 		// Live location message
 		locMsg := msg.Message.GetLiveLocationMessage()
-		messageData["type"] = "live_location"
-		messageData["latitude"] = locMsg.GetDegreesLatitude()
-		messageData["longitude"] = locMsg.GetDegreesLongitude()
-		messageData["accuracy"] = locMsg.GetAccuracyInMeters()
-		messageData["speed"] = locMsg.GetSpeedInMps()
-		messageData["bearing"] = locMsg.GetDegreesClockwiseFromMagneticNorth()
-		messageData["caption"] = locMsg.GetCaption()
+		messageData.Type = "live_location"
+		messageData.Latitude = proto.Float64(locMsg.GetDegreesLatitude())
+		messageData.Longitude = proto.Float64(locMsg.GetDegreesLongitude())
+		messageData.Accuracy = proto.Uint32(locMsg.GetAccuracyInMeters())
+		messageData.Speed = proto.Float32(locMsg.GetSpeedInMps())
+		messageData.Bearing = proto.Uint32(locMsg.GetDegreesClockwiseFromMagneticNorth())
+		messageData.Caption = locMsg.GetCaption()
 
 		// Extract mentions
 		if locMsg.ContextInfo != nil {
@@ -2428,13 +2276,13 @@ func (cm *ClientManager) extractMessageData(client *WhatsAppClient, message inte
 	case msg.Message.GetLocationMessage() != nil:
 		// Static location message
 		locMsg := msg.Message.GetLocationMessage()
-		messageData["type"] = "location"
-		messageData["latitude"] = locMsg.GetDegreesLatitude()
-		messageData["longitude"] = locMsg.GetDegreesLongitude()
-		messageData["name"] = locMsg.GetName()
-		messageData["address"] = locMsg.GetAddress()
+		messageData.Type = "location"
+		messageData.Latitude = proto.Float64(locMsg.GetDegreesLatitude())
+		messageData.Longitude = proto.Float64(locMsg.GetDegreesLongitude())
+		messageData.Name = locMsg.GetName()
+		messageData.Address = locMsg.GetAddress()
 		if locMsg.GetURL() != "" {
-			messageData["url"] = locMsg.GetURL()
+			messageData.URL = locMsg.GetURL()
 		}
 
 		// Extract mentions
@@ -2449,35 +2297,47 @@ func (cm *ClientManager) extractMessageData(client *WhatsAppClient, message inte
 
 	default:
 		// Other message types
-		messageData["type"] = "other"
+		messageData.Type = "other"
 	}
 
 	// Add mentions to message data
-	if len(mentions) > 0 {
-		messageData["mentions"] = mentions
-	}
+	messageData.Mentions = mentions
 
 	// Add isGroup flag and myPhone
-	messageData["isGroup"] = msg.Info.IsGroup
+	messageData.IsGroup = msg.Info.IsGroup
 	if client.deviceStore.ID != nil {
-		messageData["myPhone"] = client.deviceStore.ID.User
+		messageData.MyPhone = client.deviceStore.ID.User
 	}
 
 	// Add file access URL if media file was downloaded
-	if messageData["type"] != "text" {
-		client.mutex.RLock()
-		if _, exists := client.images[msg.Info.ID]; exists {
+	if messageData.Type != "text" {
+		if record, err := cm.getMedia(context.Background(), clientID, msg.Info.ID); err != nil {
+			LogDatabase.Warn("Failed to look up media for %s: %v", msg.Info.ID, err)
+		} else if record == nil && hasDownloadableMedia(msg.Message) && cm.getClientSettings(clientID).AutoDownloadMedia {
+			// Still downloading; a media.ready or media.failed status webhook will follow
+			messageData.MediaStatus = "pending"
+		} else if record != nil {
 			// Use clientID directly (it's already a UUID, no need to sanitize)
-			messageData["fileUrl"] = fmt.Sprintf("%s/files/%s/%s", baseURL, clientID, msg.Info.ID)
+			fileURL, expiresAt := signedFileURL(clientID, msg.Info.ID, fileURLTTL)
+			messageData.FileURL = fileURL
+			messageData.FileURLExpiresAt = expiresAt.Unix()
 		}
-		client.mutex.RUnlock()
 	}
 
-	return map[string]interface{}{
-		"clientId":  clientID,
-		"message":   messageData,
-		"timestamp": time.Now().Unix(),
+	webhookData := MessageWebhook{
+		SchemaVersion: WebhookSchemaVersion,
+		Event:         messageWebhookEvent,
+		ClientID:      clientID,
+		Timestamp:     time.Now().Unix(),
+		Message:       messageData,
+	}
+
+	// Let the backend know a human operator is handling this chat
+	if client.isChatPaused(msg.Info.Chat) {
+		webhookData.BotPaused = true
 	}
+
+	return webhookData
 }
 
 func loadExistingClients(container *sqlstore.Container) error {
@@ -2491,21 +2351,8 @@ func loadExistingClients(container *sqlstore.Container) error {
 
 	for i, deviceStore := range devices {
 			LogDatabase.Debug("Loading device %d/%d: ID=%v", i+1, len(devices), deviceStore.ID)
-		clientLog := waLog.Stdout("Client", "DEBUG", true)
-		client := whatsmeow.NewClient(deviceStore, clientLog)
-
-		waClient := &WhatsAppClient{
-			client:       client,
-			deviceStore:  deviceStore,
-			isConnected:  false,
-			messages:     make([]string, 0),
-			images:       make(map[string]string),
-			osName:       "", // Empty for existing clients
-			typingTimers: make(map[string]*time.Timer),
-			typingActive: make(map[string]bool),
-		}
-
-		client.AddEventHandler(manager.eventHandler(waClient))
+		waClient := manager.newWhatsAppClient(deviceStore, "") // OS name is empty for existing clients
+		client := waClient.client
 
 		// Use UUID from mapping if available, otherwise generate deterministic UUID from WhatsApp ID
 		whatsappID := deviceStore.ID.String()
@@ -2532,15 +2379,7 @@ func loadExistingClients(container *sqlstore.Container) error {
 		// Auto-connect if device has existing session
 		if client.Store.ID != nil {
 			LogClient.Info("Attempting to auto-reconnect client %s (Device ID: %s)", clientID, client.Store.ID.String())
-			localClientID := clientID // Capture for closure
-			go func() {
-				err := client.Connect()
-				if err != nil {
-					LogClient.Error("Failed to reconnect client %s: %v", localClientID, err)
-				} else {
-					LogClient.Info("Successfully reconnected client %s", localClientID)
-				}
-			}()
+			manager.connectExisting(waClient, clientID)
 		} else {
 			LogClient.Debug("Skipping auto-connect for client %s (no device ID)", clientID)
 		}
@@ -2578,50 +2417,14 @@ func recreatePendingClients(container *sqlstore.Container) error {
 			continue
 		}
 
-		clientLog := waLog.Stdout("Client", "DEBUG", true)
-		client := whatsmeow.NewClient(deviceStore, clientLog)
-
-		waClient := &WhatsAppClient{
-			client:       client,
-			deviceStore:  deviceStore,
-			isConnected:  false,
-			messages:     make([]string, 0),
-			images:       make(map[string]string),
-			osName:       pendingClient.OSName,
-			typingTimers: make(map[string]*time.Timer),
-			typingActive: make(map[string]bool),
-		}
-
-		client.AddEventHandler(manager.eventHandler(waClient))
+		waClient := manager.newWhatsAppClient(deviceStore, pendingClient.OSName)
+		waClient.state = StatePairing
 		manager.clients[clientID] = waClient
 
 		LogClient.Info("Successfully recreated pending client: %s", clientID)
 
 		// Start connection process in background
-		localClientID := clientID
-		localWaClient := waClient
-		go func() {
-			qrChan, err := localWaClient.client.GetQRChannel(context.Background())
-			if err != nil {
-				LogQR.Error("Failed to get QR channel for pending client %s: %v", localClientID, err)
-				return
-			}
-
-			err = localWaClient.client.Connect()
-			if err != nil {
-				LogClient.Error("Failed to connect pending client %s: %v", localClientID, err)
-				return
-			}
-
-			for evt := range qrChan {
-				if evt.Event == "code" {
-					localWaClient.mutex.Lock()
-					localWaClient.qrCode = evt.Code
-					localWaClient.mutex.Unlock()
-					LogQR.Debug("QR code received for pending client %s", localClientID)
-				}
-			}
-		}()
+		go manager.startPairing(clientID, waClient)
 	}
 
 	LogClient.Info("Finished recreating %d pending client(s)", len(manager.pendingClients))
@@ -2653,6 +2456,7 @@ func startTypingHandler(c *gin.Context) {
 	}
 
 	var req struct {
+		To    string `json:"to"`
 		Phone string `json:"phone"`
 	}
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -2660,21 +2464,14 @@ func startTypingHandler(c *gin.Context) {
 		return
 	}
 
-	// Format phone number
-	targetJID := strings.TrimSuffix(req.Phone, "@s.whatsapp.net")
-	if !strings.Contains(targetJID, "@") {
-		targetJID += "@s.whatsapp.net"
-	}
-
-	// Parse JID
-	targetJIDParsed, err := types.ParseJID(targetJID)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid phone number format: %v", err)})
+	// Resolve the recipient from "to", falling back to the legacy "phone"
+	targetJIDParsed, ok := bindRecipient(c, clientID, req.To, req.Phone)
+	if !ok {
 		return
 	}
 
 	// Start typing
-	manager.startTyping(waClient, targetJIDParsed)
+	manager.startTyping(waClient, targetJIDParsed, manager.getClientSettings(clientID).typingTimeout())
 	c.JSON(http.StatusOK, gin.H{"success": true})
 }
 
@@ -2703,6 +2500,7 @@ func stopTypingHandler(c *gin.Context) {
 	}
 
 	var req struct {
+		To    string `json:"to"`
 		Phone string `json:"phone"`
 	}
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -2710,16 +2508,9 @@ func stopTypingHandler(c *gin.Context) {
 		return
 	}
 
-	// Format phone number
-	targetJID := strings.TrimSuffix(req.Phone, "@s.whatsapp.net")
-	if !strings.Contains(targetJID, "@") {
-		targetJID += "@s.whatsapp.net"
-	}
-
-	// Parse JID
-	targetJIDParsed, err := types.ParseJID(targetJID)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid phone number format: %v", err)})
+	// Resolve the recipient from "to", falling back to the legacy "phone"
+	targetJIDParsed, ok := bindRecipient(c, clientID, req.To, req.Phone)
+	if !ok {
 		return
 	}
 
@@ -2784,16 +2575,61 @@ func main() {
 	}
 
 	LogDatabase.Info("Initializing database container at: %s", dbPath)
-	container, err := sqlstore.New(ctx, "sqlite3", fmt.Sprintf("file:%s?_foreign_keys=on", dbPath), dbLog)
+	// Open the database ourselves so aimeow's own tables share it with whatsmeow
+	db, err := sql.Open("sqlite3", fmt.Sprintf("file:%s?_foreign_keys=on&_busy_timeout=5000", dbPath))
 	if err != nil {
+		panic(fmt.Errorf("failed to open database: %w", err))
+	}
+	container := sqlstore.NewWithDB(db, "sqlite3", dbLog)
+	if err := container.Upgrade(ctx); err != nil {
 		panic(fmt.Errorf("failed to initialize database container: %w", err))
 	}
 	LogDatabase.Info("Database container initialized successfully")
 
+	mediaTableCreated, err := initMediaStore(ctx, db)
+	if err != nil {
+		panic(err)
+	}
+	if err := initJIDResolver(ctx, db); err != nil {
+		panic(err)
+	}
+	if err := initDeliveryLog(ctx, db); err != nil {
+		panic(err)
+	}
+	if err := initWebhookSubscriptions(ctx, db); err != nil {
+		panic(err)
+	}
+	if err := initEventLog(ctx, db); err != nil {
+		panic(err)
+	}
+	if err := initMediaStorage(); err != nil {
+		panic(err)
+	}
+	if err := initFileURLSigning(); err != nil {
+		panic(err)
+	}
+
 	// Initialize client manager with config path
 	configPath := filepath.Join(dataDir, "config.json")
 	LogConfig.Info("Configuration file path: %s", configPath)
-	manager = NewClientManager(container, configPath)
+	manager = NewClientManager(container, db, configPath)
+	if mediaTableCreated {
+		manager.backfillMediaIndex(ctx)
+	}
+
+	// "aimeow migrate-media ..." moves files between storage backends instead of starting the server
+	if len(os.Args) > 1 && os.Args[1] == "migrate-media" {
+		if err := runMigrateMediaCommand(ctx, os.Args[2:]); err != nil {
+			LogMedia.Error("Media migration failed: %v", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	go manager.runMediaSweeper()
+	go manager.runDeliveryPruner()
+	go manager.runEventLogPruner()
+	manager.startMediaWorkers()
 
 	// Load existing clients
 	LogClient.Info("Loading existing clients...")
@@ -2832,8 +2668,35 @@ func main() {
 			clients.GET("", getAllClients)
 			clients.GET("/:id", getClient)
 			clients.GET("/:id/qr", getQRCode)
+			clients.GET("/:id/qr.png", getQRCodePNG)
+			clients.GET("/:id/qr.svg", getQRCodeSVG)
+			clients.GET("/:id/qr/events", streamQREvents)
+			clients.POST("/:id/qr/regenerate", regenerateQRCode)
 			clients.GET("/:id/messages", getMessages)
 			clients.DELETE("/:id", deleteClient)
+			clients.POST("/:id/connect", connectClient)
+			clients.POST("/:id/disconnect", disconnectClient)
+			clients.GET("/:id/queue", getEventQueueMetrics)
+			clients.GET("/:id/settings", getClientSettingsHandler)
+			clients.PATCH("/:id/settings", updateClientSettingsHandler)
+
+			// Human takeover endpoints
+			clients.POST("/:id/chats/pause", pauseChatHandler)
+			clients.POST("/:id/chats/resume", resumeChatHandler)
+			clients.GET("/:id/chats/paused", getPausedChats)
+
+			// Blocklist and privacy endpoints
+			clients.GET("/:id/blocklist", getBlocklist)
+			clients.POST("/:id/block", blockContact)
+			clients.POST("/:id/unblock", unblockContact)
+			clients.GET("/:id/privacy", getPrivacySettings)
+			clients.PATCH("/:id/privacy", updatePrivacySettings)
+
+			// Own profile endpoints
+			clients.GET("/:id/profile", getOwnProfile)
+			clients.PATCH("/:id/profile", updateOwnProfile)
+			clients.PUT("/:id/profile/picture", setOwnProfilePicture)
+			clients.DELETE("/:id/profile/picture", removeOwnProfilePicture)
 
 			// Send message endpoints
 			clients.POST("/:id/send-message", sendMessage)
@@ -2842,6 +2705,12 @@ func main() {
 			clients.POST("/:id/send-document", sendDocument)
 			clients.POST("/:id/send-document-base64", sendDocumentBase64)
 			clients.POST("/:id/delete-message", deleteMessage)
+			clients.POST("/:id/forward", forwardMessage)
+
+			// Media storage endpoints
+			clients.GET("/:id/storage", getClientStorage)
+			clients.POST("/:id/storage/purge", purgeClientStorage)
+			clients.POST("/:id/files/:file_id/url", mintFileURL)
 
 			// Typing indicator endpoints
 			clients.POST("/:id/start-typing", startTypingHandler)
@@ -2850,17 +2719,39 @@ func main() {
 			// Contact info endpoints
 			clients.GET("/:id/profile-picture/:phone", getProfilePicture)
 			clients.GET("/:id/check-whatsapp/:phone", checkWhatsApp)
+			clients.POST("/:id/check-whatsapp", bulkCheckWhatsAppHandler)
+			clients.GET("/:id/contacts/:jid/profile", getContactProfile)
+			clients.GET("/:id/resolve/:jid", resolveJID)
+			clients.POST("/:id/resolve", resolveJIDsBatch)
 		}
 
 		// Config endpoints
 		v1.POST("/config", setConfig)
 		v1.GET("/config", getConfig)
 
+		// Webhook payload schemas
+		v1.GET("/webhooks/schemas", listWebhookSchemas)
+		v1.GET("/webhooks/schemas/:event", getWebhookSchema)
+
+		// Webhook subscription endpoints
+		v1.GET("/webhooks/subscriptions", listWebhookSubscriptions)
+		v1.POST("/webhooks/subscriptions", createWebhookSubscription)
+		v1.GET("/webhooks/subscriptions/:sub_id", getWebhookSubscriptionHandler)
+		v1.PATCH("/webhooks/subscriptions/:sub_id", updateWebhookSubscription)
+		v1.DELETE("/webhooks/subscriptions/:sub_id", deleteWebhookSubscriptionHandler)
+		v1.POST("/webhooks/subscriptions/:sub_id/test", testWebhookSubscriptionHandler)
+
+		// Event log for consumers that missed webhooks
+		v1.GET("/events/log", getEventLog)
+
 		// QR code HTML endpoint
 		r.GET("/qr", getQRCodeHTML)
 
 		// Serve client files
 		r.GET("/files/:client_id/:file_id", getClientFile)
+
+		// Serve cached profile pictures
+		r.GET("/avatars/:client_id/:jid", getAvatarHandler)
 	}
 
 	// Health check
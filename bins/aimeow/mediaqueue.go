@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strconv"
+	"time"
+
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+const (
+	// defaultMediaWorkers is how many downloads run at once unless MEDIA_WORKERS says otherwise
+	defaultMediaWorkers = 4
+
+	// mediaQueueSize bounds the downloads waiting for a worker; beyond it new media fails fast
+	mediaQueueSize = 256
+
+	mediaDownloadTimeout = 10 * time.Minute
+)
+
+var (
+	errNoMedia       = errors.New("message has no downloadable media")
+	errMediaTooLarge = errors.New("media exceeds the size limit")
+)
+
+type mediaJob struct {
+	client   *WhatsAppClient
+	clientID string
+	msg      *events.Message
+}
+
+// hasDownloadableMedia reports whether a message carries media that is saved to storage
+func hasDownloadableMedia(msg *waE2E.Message) bool {
+	return msg.GetImageMessage() != nil || msg.GetVideoMessage() != nil || msg.GetAudioMessage() != nil || msg.GetDocumentMessage() != nil
+}
+
+// startMediaWorkers starts the pool that downloads media outside the event handler
+func (cm *ClientManager) startMediaWorkers() {
+	workers := defaultMediaWorkers
+	if n, err := strconv.Atoi(os.Getenv("MEDIA_WORKERS")); err == nil && n > 0 {
+		workers = n
+	}
+
+	cm.mediaJobs = make(chan mediaJob, mediaQueueSize)
+	for i := 0; i < workers; i++ {
+		go cm.runMediaWorker()
+	}
+	LogMedia.Info("Started %d media download workers", workers)
+}
+
+// enqueueMediaDownload hands a message to the worker pool without blocking the event handler.
+// If the pool is full it returns the task reporting media.failed, to run after the message webhook.
+func (cm *ClientManager) enqueueMediaDownload(client *WhatsAppClient, clientID string, msg *events.Message) []eventTask {
+	if clientID == "" {
+		return nil
+	}
+
+	select {
+	case cm.mediaJobs <- mediaJob{client: client, clientID: clientID, msg: msg}:
+		LogMedia.Debug("Queued media of %s for client %s (%d waiting)", msg.Info.ID, clientID, len(cm.mediaJobs))
+		return nil
+	default:
+		LogMedia.Warn("Media queue full, not downloading %s for client %s", msg.Info.ID, clientID)
+		return []eventTask{{lane: msg.Info.Chat.String(), run: func() {
+			cm.sendMediaFailed(clientID, msg, "queue_full", errors.New("media download queue is full"))
+		}}}
+	}
+}
+
+func (cm *ClientManager) runMediaWorker() {
+	for job := range cm.mediaJobs {
+		ctx, cancel := context.WithTimeout(context.Background(), mediaDownloadTimeout)
+		record, err := cm.downloadImage(ctx, job.client, job.clientID, job.msg)
+		cancel()
+
+		if err != nil {
+			LogMedia.Error("Failed to download media of %s for client %s: %v", job.msg.Info.ID, job.clientID, err)
+			reason := "download_failed"
+			if errors.Is(err, errMediaTooLarge) {
+				reason = "too_large"
+			}
+			cm.sendMediaFailed(job.clientID, job.msg, reason, err)
+			continue
+		}
+		cm.sendMediaReady(job.clientID, job.msg, record)
+	}
+}
+
+func (cm *ClientManager) sendMediaReady(clientID string, msg *events.Message, record *MediaRecord) {
+	fileURL, expiresAt := signedFileURL(clientID, record.MessageID, fileURLTTL)
+	cm.sendConnectionStatusWebhook(clientID, "media.ready", MediaReadyData{
+		MessageID:        record.MessageID,
+		Chat:             msg.Info.Chat.String(),
+		MediaType:        record.MediaType,
+		MimeType:         record.MimeType,
+		FileName:         record.FileName,
+		FileSize:         record.Size,
+		SHA256:           record.SHA256,
+		FileURL:          fileURL,
+		FileURLExpiresAt: expiresAt.Unix(),
+	})
+}
+
+func (cm *ClientManager) sendMediaFailed(clientID string, msg *events.Message, reason string, err error) {
+	cm.sendConnectionStatusWebhook(clientID, "media.failed", MediaFailedData{
+		MessageID: msg.Info.ID,
+		Chat:      msg.Info.Chat.String(),
+		Reason:    reason,
+		Error:     err.Error(),
+	})
+}
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// MediaRecord is a downloaded media file indexed in the database
+type MediaRecord struct {
+	ClientID  string    `json:"clientId"`
+	MessageID string    `json:"messageId"`
+	Chat      string    `json:"chat,omitempty"`
+	MediaType string    `json:"mediaType"`
+	Backend   string    `json:"backend"`
+	Path      string    `json:"-"` // Storage key: clientID/messageID.ext
+	MimeType  string    `json:"mimeType"`
+	FileName  string    `json:"fileName"`
+	Size      int64     `json:"size"`
+	SHA256    string    `json:"sha256"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+const mediaSchema = `
+CREATE TABLE IF NOT EXISTS aimeow_media (
+	client_id  TEXT    NOT NULL,
+	message_id TEXT    NOT NULL,
+	chat       TEXT    NOT NULL DEFAULT '',
+	media_type TEXT    NOT NULL,
+	path       TEXT    NOT NULL,
+	mime_type  TEXT    NOT NULL,
+	file_name  TEXT    NOT NULL,
+	size       INTEGER NOT NULL,
+	sha256     TEXT    NOT NULL,
+	created_at INTEGER NOT NULL,
+	backend    TEXT    NOT NULL DEFAULT 'local',
+	PRIMARY KEY (client_id, message_id)
+)`
+
+// initMediaStore creates the media table next to whatsmeow's tables. It reports whether the table
+// is new, in which case files downloaded before it existed still have to be indexed.
+func initMediaStore(ctx context.Context, db *sql.DB) (bool, error) {
+	var exists bool
+	if err := db.QueryRowContext(ctx, "SELECT COUNT(*) > 0 FROM sqlite_master WHERE type='table' AND name='aimeow_media'").Scan(&exists); err != nil {
+		return false, fmt.Errorf("failed to inspect media table: %w", err)
+	}
+	if _, err := db.ExecContext(ctx, mediaSchema); err != nil {
+		return false, fmt.Errorf("failed to create media table: %w", err)
+	}
+	return !exists, nil
+}
+
+// saveMedia records a downloaded media file, replacing any earlier record for the message
+func (cm *ClientManager) saveMedia(ctx context.Context, record MediaRecord) error {
+	_, err := cm.db.ExecContext(ctx, `
+		INSERT INTO aimeow_media (client_id, message_id, chat, media_type, backend, path, mime_type, file_name, size, sha256, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (client_id, message_id) DO UPDATE SET
+			chat=excluded.chat, media_type=excluded.media_type, backend=excluded.backend, path=excluded.path, mime_type=excluded.mime_type,
+			file_name=excluded.file_name, size=excluded.size, sha256=excluded.sha256, created_at=excluded.created_at`,
+		record.ClientID, record.MessageID, record.Chat, record.MediaType, record.Backend, record.Path, record.MimeType,
+		record.FileName, record.Size, record.SHA256, record.CreatedAt.Unix())
+	if err != nil {
+		return fmt.Errorf("failed to save media record: %w", err)
+	}
+	return nil
+}
+
+// getMedia looks up a media record. It returns nil if the message has no indexed media.
+func (cm *ClientManager) getMedia(ctx context.Context, clientID, messageID string) (*MediaRecord, error) {
+	record := MediaRecord{ClientID: clientID, MessageID: messageID}
+	var createdAt int64
+	err := cm.db.QueryRowContext(ctx, `
+		SELECT chat, media_type, backend, path, mime_type, file_name, size, sha256, created_at
+		FROM aimeow_media WHERE client_id=? AND message_id=?`, clientID, messageID).
+		Scan(&record.Chat, &record.MediaType, &record.Backend, &record.Path, &record.MimeType, &record.FileName, &record.Size, &record.SHA256, &createdAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to get media record: %w", err)
+	}
+	record.CreatedAt = time.Unix(createdAt, 0)
+	return &record, nil
+}
+
+// queryMedia returns the media records of a client matching an extra condition, oldest first
+func (cm *ClientManager) queryMedia(ctx context.Context, clientID string, condition string, args ...interface{}) ([]MediaRecord, error) {
+	where := "client_id=?"
+	if condition != "" {
+		where += " AND " + condition
+	}
+	return cm.selectMedia(ctx, where, append([]interface{}{clientID}, args...)...)
+}
+
+// mediaOnBackend returns the media records of every client kept on a storage backend
+func (cm *ClientManager) mediaOnBackend(ctx context.Context, backend string) ([]MediaRecord, error) {
+	return cm.selectMedia(ctx, "backend=?", backend)
+}
+
+func (cm *ClientManager) selectMedia(ctx context.Context, where string, args ...interface{}) ([]MediaRecord, error) {
+	rows, err := cm.db.QueryContext(ctx, `
+		SELECT client_id, message_id, chat, media_type, backend, path, mime_type, file_name, size, sha256, created_at
+		FROM aimeow_media WHERE `+where+` ORDER BY created_at ASC`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query media records: %w", err)
+	}
+	defer rows.Close()
+
+	var records []MediaRecord
+	for rows.Next() {
+		var record MediaRecord
+		var createdAt int64
+		if err := rows.Scan(&record.ClientID, &record.MessageID, &record.Chat, &record.MediaType, &record.Backend, &record.Path,
+			&record.MimeType, &record.FileName, &record.Size, &record.SHA256, &createdAt); err != nil {
+			return nil, fmt.Errorf("failed to scan media record: %w", err)
+		}
+		record.CreatedAt = time.Unix(createdAt, 0)
+		records = append(records, record)
+	}
+	return records, rows.Err()
+}
+
+// deleteMedia removes a media file from its storage backend and its record
+func (cm *ClientManager) deleteMedia(ctx context.Context, record MediaRecord) error {
+	backend, err := storageBackend(record.Backend)
+	if err != nil {
+		return err
+	}
+	if err := backend.Delete(ctx, record.Path); err != nil {
+		return fmt.Errorf("failed to remove %s from %s storage: %w", record.Path, record.Backend, err)
+	}
+	if _, err := cm.db.ExecContext(ctx, "DELETE FROM aimeow_media WHERE client_id=? AND message_id=?", record.ClientID, record.MessageID); err != nil {
+		return fmt.Errorf("failed to delete media record: %w", err)
+	}
+	return nil
+}
+
+// deleteClientMediaRecords removes every media record of a client
+func (cm *ClientManager) deleteClientMediaRecords(ctx context.Context, clientID string) error {
+	if _, err := cm.db.ExecContext(ctx, "DELETE FROM aimeow_media WHERE client_id=?", clientID); err != nil {
+		return fmt.Errorf("failed to delete media records: %w", err)
+	}
+	return nil
+}
+
+// hashFile returns the hex sha256 and size of a file
+func hashFile(path string) (string, int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", 0, err
+	}
+	defer f.Close()
+
+	hash := sha256.New()
+	size, err := io.Copy(hash, f)
+	if err != nil {
+		return "", 0, err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), size, nil
+}
+
+// mediaTypeForMime maps a MIME type to the media type names used in webhooks
+func mediaTypeForMime(mimeType string) string {
+	switch {
+	case strings.HasPrefix(mimeType, "image/"):
+		return "image"
+	case strings.HasPrefix(mimeType, "video/"):
+		return "video"
+	case strings.HasPrefix(mimeType, "audio/"):
+		return "audio"
+	}
+	return "document"
+}
+
+// backfillMediaIndex indexes files downloaded before the media table existed, so their /files
+// URLs keep working. It runs once, right after the table is created.
+func (cm *ClientManager) backfillMediaIndex(ctx context.Context) {
+	filesDir := filepath.Join(dataDir, "files")
+	clientDirs, err := os.ReadDir(filesDir)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			LogMedia.Warn("Failed to read media directory for backfill: %v", err)
+		}
+		return
+	}
+
+	indexed := 0
+	for _, clientDir := range clientDirs {
+		if !clientDir.IsDir() {
+			continue
+		}
+		clientID := clientDir.Name()
+		files, err := os.ReadDir(filepath.Join(filesDir, clientID))
+		if err != nil {
+			continue
+		}
+		for _, file := range files {
+			if file.IsDir() || strings.HasSuffix(file.Name(), ".tmp") {
+				continue
+			}
+			ext := filepath.Ext(file.Name())
+			messageID := strings.TrimSuffix(file.Name(), ext)
+
+			path := filepath.Join(filesDir, clientID, file.Name())
+			sum, size, err := hashFile(path)
+			if err != nil {
+				LogMedia.Warn("Failed to hash %s during backfill: %v", path, err)
+				continue
+			}
+			info, err := file.Info()
+			if err != nil {
+				continue
+			}
+
+			mimeType := mime.TypeByExtension(ext)
+			if mimeType == "" {
+				mimeType = "application/octet-stream"
+			}
+			record := MediaRecord{
+				ClientID:  clientID,
+				MessageID: messageID,
+				MediaType: mediaTypeForMime(mimeType),
+				Backend:   StorageLocal,
+				Path:      clientID + "/" + file.Name(),
+				MimeType:  mimeType,
+				FileName:  file.Name(),
+				Size:      size,
+				SHA256:    sum,
+				CreatedAt: info.ModTime(),
+			}
+			if err := cm.saveMedia(ctx, record); err != nil {
+				LogMedia.Warn("Failed to index %s during backfill: %v", path, err)
+				continue
+			}
+			indexed++
+		}
+	}
+
+	if indexed > 0 {
+		LogMedia.Info("Indexed %d media files downloaded before the media table existed", indexed)
+	}
+}
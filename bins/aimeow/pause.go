@@ -0,0 +1,251 @@
+package main
+
+import (
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mau.fi/whatsmeow/types"
+)
+
+// Reasons a chat can be paused
+const (
+	PauseReasonManual        = "manual"
+	PauseReasonOperatorReply = "operator_reply"
+)
+
+// ChatPause records that the bot is paused in a chat because a human has taken over
+type ChatPause struct {
+	Chat         string    `json:"chat"`
+	Reason       string    `json:"reason"`
+	PausedAt     time.Time `json:"pausedAt"`
+	LastActivity time.Time `json:"lastActivity"`
+	ExpiresAt    time.Time `json:"expiresAt"`
+
+	timer *time.Timer
+}
+
+type PauseChatRequest struct {
+	Chat               string `json:"chat" binding:"required"`
+	IdleTimeoutSeconds int    `json:"idleTimeoutSeconds,omitempty" binding:"omitempty,min=1"`
+}
+
+type ResumeChatRequest struct {
+	Chat string `json:"chat" binding:"required"`
+}
+
+type PausedChatsResponse struct {
+	Chats []ChatPause `json:"chats"`
+}
+
+// isChatPaused reports whether the bot is paused in a chat
+func (client *WhatsAppClient) isChatPaused(chat types.JID) bool {
+	client.pauseMutex.Lock()
+	defer client.pauseMutex.Unlock()
+
+	_, paused := client.pausedChats[chat.String()]
+	return paused
+}
+
+// pauseChat pauses the bot in a chat, or extends an existing pause, until idleTimeout passes without activity.
+// It returns the pause as it stands and, if the chat was not paused before, the task sending chat_paused on
+// the chat's lane. It may be called with client.mutex held, so the caller submits the tasks.
+func (cm *ClientManager) pauseChat(client *WhatsAppClient, clientID string, chat types.JID, reason string, idleTimeout time.Duration) (ChatPause, []eventTask) {
+	chatID := chat.String()
+	now := time.Now()
+
+	client.pauseMutex.Lock()
+	pause, exists := client.pausedChats[chatID]
+	if !exists {
+		pause = &ChatPause{Chat: chatID, Reason: reason, PausedAt: now}
+		client.pausedChats[chatID] = pause
+	} else if pause.timer != nil {
+		pause.timer.Stop()
+	}
+	pause.LastActivity = now
+	pause.ExpiresAt = now.Add(idleTimeout)
+	pause.timer = time.AfterFunc(idleTimeout, func() {
+		cm.resumeChat(client, clientID, chat, "idle_timeout")
+	})
+	snapshot := *pause
+	client.pauseMutex.Unlock()
+
+	if exists {
+		return snapshot, nil
+	}
+
+	LogMessage.Info("Bot paused in chat %s for client %s (%s)", chatID, clientID, reason)
+	return snapshot, []eventTask{{lane: chatID, run: func() {
+		cm.sendConnectionStatusWebhook(clientID, "chat_paused", ChatPausedData{
+			Chat:      chatID,
+			Reason:    reason,
+			ExpiresAt: snapshot.ExpiresAt.Unix(),
+		})
+	}}}
+}
+
+// resumeChat lifts a pause and queues chat_resumed on the chat's lane. It returns false if the chat wasn't paused.
+// Must not be called with client.mutex held.
+func (cm *ClientManager) resumeChat(client *WhatsAppClient, clientID string, chat types.JID, reason string) bool {
+	chatID := chat.String()
+
+	client.pauseMutex.Lock()
+	pause, exists := client.pausedChats[chatID]
+	if exists {
+		if pause.timer != nil {
+			pause.timer.Stop()
+		}
+		delete(client.pausedChats, chatID)
+	}
+	client.pauseMutex.Unlock()
+
+	if !exists {
+		return false
+	}
+
+	LogMessage.Info("Bot resumed in chat %s for client %s (%s)", chatID, clientID, reason)
+	client.events.submit(eventTask{lane: chatID, run: func() {
+		cm.sendConnectionStatusWebhook(clientID, "chat_resumed", ChatResumedData{
+			Chat:   chatID,
+			Reason: reason,
+		})
+	}})
+	return true
+}
+
+// clearPausedChats stops all pause timers, used when a client is torn down
+func (client *WhatsAppClient) clearPausedChats() {
+	client.pauseMutex.Lock()
+	defer client.pauseMutex.Unlock()
+
+	for chatID, pause := range client.pausedChats {
+		if pause.timer != nil {
+			pause.timer.Stop()
+		}
+		delete(client.pausedChats, chatID)
+	}
+}
+
+// isOperatorReply reports whether an own message was sent from the phone or another linked
+// device rather than through this API. Messages sent by this client are never echoed back.
+func isOperatorReply(client *WhatsAppClient, info types.MessageInfo) bool {
+	if !info.IsFromMe {
+		return false
+	}
+	if client.deviceStore.ID != nil && info.Sender.Device == client.deviceStore.ID.Device {
+		return false
+	}
+	return true
+}
+
+// @Summary Pause bot in a chat
+// @Description Pauses automatic read receipts and typing in a chat so a human operator can take over
+// @Tags chats
+// @Accept json
+// @Produce json
+// @Param id path string true "Client ID"
+// @Param pause body PauseChatRequest true "Chat to pause"
+// @Success 200 {object} ChatPause
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /clients/{id}/chats/pause [post]
+func pauseChatHandler(c *gin.Context) {
+	clientID := c.Param("id")
+
+	waClient, err := manager.getClient(clientID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	var req PauseChatRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	chatJID, err := parseChatJID(clientID, req.Chat)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	idleTimeout := manager.getClientSettings(clientID).pauseIdleTimeout()
+	if req.IdleTimeoutSeconds > 0 {
+		idleTimeout = time.Duration(req.IdleTimeoutSeconds) * time.Second
+	}
+
+	pause, tasks := manager.pauseChat(waClient, clientID, chatJID, PauseReasonManual, idleTimeout)
+	waClient.events.submit(tasks...)
+
+	// The bot is no longer answering, so don't leave it looking like it's typing
+	go manager.stopTyping(waClient, chatJID)
+
+	c.JSON(http.StatusOK, pause)
+}
+
+// @Summary Resume bot in a chat
+// @Description Ends a human takeover so the bot handles the chat again
+// @Tags chats
+// @Accept json
+// @Produce json
+// @Param id path string true "Client ID"
+// @Param resume body ResumeChatRequest true "Chat to resume"
+// @Success 200 {object} map[string]bool
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /clients/{id}/chats/resume [post]
+func resumeChatHandler(c *gin.Context) {
+	clientID := c.Param("id")
+
+	waClient, err := manager.getClient(clientID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	var req ResumeChatRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	chatJID, err := parseChatJID(clientID, req.Chat)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	resumed := manager.resumeChat(waClient, clientID, chatJID, PauseReasonManual)
+	c.JSON(http.StatusOK, gin.H{"success": true, "wasPaused": resumed})
+}
+
+// @Summary List paused chats
+// @Description Returns the chats where the bot is currently paused
+// @Tags chats
+// @Produce json
+// @Param id path string true "Client ID"
+// @Success 200 {object} PausedChatsResponse
+// @Failure 404 {object} map[string]string
+// @Router /clients/{id}/chats/paused [get]
+func getPausedChats(c *gin.Context) {
+	waClient, err := manager.getClient(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	waClient.pauseMutex.Lock()
+	response := PausedChatsResponse{Chats: make([]ChatPause, 0, len(waClient.pausedChats))}
+	for _, pause := range waClient.pausedChats {
+		response.Chats = append(response.Chats, *pause)
+	}
+	waClient.pauseMutex.Unlock()
+
+	sort.Slice(response.Chats, func(i, j int) bool {
+		return response.Chats[i].PausedAt.Before(response.Chats[j].PausedAt)
+	})
+
+	c.JSON(http.StatusOK, response)
+}
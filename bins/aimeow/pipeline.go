@@ -0,0 +1,230 @@
+package main
+
+import (
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// eventQueueSize bounds how many tasks a client may have waiting. When it's full the event
+// handler blocks, which in turn slows down whatsmeow instead of piling up goroutines.
+const eventQueueSize = 1024
+
+const (
+	// clientLane is the ordering key for work that isn't tied to a chat, such as status webhooks
+	clientLane = ""
+
+	// profileLane keeps slow profile lookups from holding up status webhooks
+	profileLane = "profile"
+
+	// resolverLane imports LID mappings from history syncs, which can hold thousands at once
+	resolverLane = "resolver"
+)
+
+// eventTask is work produced by an event. Tasks with the same lane run one at a time in order;
+// different lanes run concurrently.
+type eventTask struct {
+	lane string
+	run  func()
+}
+
+// eventQueue runs a client's event work outside client.mutex, in order per chat
+type eventQueue struct {
+	slots  chan struct{}   // one per queued or running task submitted by the event handler
+	intake chan queuedTask // FIFO read by the dispatcher
+	done   chan struct{}
+
+	lanes      map[string]*eventLane
+	lanesMutex sync.Mutex
+
+	// Metrics
+	enqueued         atomic.Uint64
+	processed        atomic.Uint64
+	panics           atomic.Uint64
+	backpressureHits atomic.Uint64
+	backpressureWait atomic.Int64 // nanoseconds
+	maxDepth         atomic.Int64
+}
+
+type queuedTask struct {
+	eventTask
+	slot bool // holds a slot that must be released after running
+}
+
+type eventLane struct {
+	tasks []queuedTask
+}
+
+// EventQueueMetrics describes the load on a client's event pipeline
+type EventQueueMetrics struct {
+	ClientID           string  `json:"clientId"`
+	Depth              int     `json:"depth"`    // tasks waiting or running
+	Capacity           int     `json:"capacity"` // depth at which the event handler blocks
+	MaxDepth           int64   `json:"maxDepth"`
+	ActiveLanes        int     `json:"activeLanes"` // chats with pending work
+	Enqueued           uint64  `json:"enqueued"`
+	Processed          uint64  `json:"processed"`
+	Panics             uint64  `json:"panics"`
+	BackpressureHits   uint64  `json:"backpressureHits"` // times the event handler had to wait for room
+	BackpressureWaitMs float64 `json:"backpressureWaitMs"`
+}
+
+func newEventQueue() *eventQueue {
+	q := &eventQueue{
+		slots: make(chan struct{}, eventQueueSize),
+		// Posts from setState don't take slots, so leave them some room of their own
+		intake: make(chan queuedTask, eventQueueSize*2),
+		done:   make(chan struct{}),
+		lanes:  make(map[string]*eventLane),
+	}
+	go q.dispatch()
+	return q
+}
+
+// submit queues tasks in order, blocking while the queue is full. Must not be called with client.mutex held.
+func (q *eventQueue) submit(tasks ...eventTask) {
+	for _, task := range tasks {
+		select {
+		case q.slots <- struct{}{}:
+		default:
+			q.backpressureHits.Add(1)
+			LogClient.Warn("Event queue full (%d tasks), waiting for room", cap(q.slots))
+			start := time.Now()
+			select {
+			case q.slots <- struct{}{}:
+				q.backpressureWait.Add(int64(time.Since(start)))
+			case <-q.done:
+				return
+			}
+		}
+
+		depth := int64(len(q.slots))
+		for current := q.maxDepth.Load(); depth > current && !q.maxDepth.CompareAndSwap(current, depth); {
+			current = q.maxDepth.Load()
+		}
+		q.enqueued.Add(1)
+		select {
+		case q.intake <- queuedTask{eventTask: task, slot: true}:
+		case <-q.done:
+			return
+		}
+	}
+}
+
+// post queues a task without waiting, for the few places that must enqueue while holding client.mutex
+func (q *eventQueue) post(task eventTask) {
+	q.enqueued.Add(1)
+	select {
+	case q.intake <- queuedTask{eventTask: task}:
+	default:
+		// Only possible under extreme load; losing the ordering beats blocking under the lock
+		LogClient.Warn("Event queue overflow, running task out of order")
+		go q.execute(queuedTask{eventTask: task})
+	}
+}
+
+// dispatch hands tasks from the intake to their lanes, starting a worker for idle lanes
+func (q *eventQueue) dispatch() {
+	for {
+		select {
+		case task := <-q.intake:
+			q.lanesMutex.Lock()
+			lane, running := q.lanes[task.lane]
+			if !running {
+				lane = &eventLane{}
+				q.lanes[task.lane] = lane
+			}
+			lane.tasks = append(lane.tasks, task)
+			q.lanesMutex.Unlock()
+
+			if !running {
+				go q.runLane(task.lane, lane)
+			}
+		case <-q.done:
+			return
+		}
+	}
+}
+
+// runLane works through a lane until it's empty, then retires it
+func (q *eventQueue) runLane(key string, lane *eventLane) {
+	for {
+		q.lanesMutex.Lock()
+		if len(lane.tasks) == 0 {
+			delete(q.lanes, key)
+			q.lanesMutex.Unlock()
+			return
+		}
+		task := lane.tasks[0]
+		lane.tasks = lane.tasks[1:]
+		q.lanesMutex.Unlock()
+
+		q.execute(task)
+	}
+}
+
+func (q *eventQueue) execute(task queuedTask) {
+	defer func() {
+		if r := recover(); r != nil {
+			q.panics.Add(1)
+			LogClient.Error("Event task panicked: %v", r)
+		}
+		if task.slot {
+			<-q.slots
+		}
+		q.processed.Add(1)
+	}()
+	task.run()
+}
+
+// stop discards pending work; used when the client is deleted
+func (q *eventQueue) stop() {
+	select {
+	case <-q.done:
+	default:
+		close(q.done)
+	}
+}
+
+func (q *eventQueue) metrics() EventQueueMetrics {
+	q.lanesMutex.Lock()
+	activeLanes := len(q.lanes)
+	q.lanesMutex.Unlock()
+
+	return EventQueueMetrics{
+		Depth:              len(q.slots),
+		Capacity:           cap(q.slots),
+		MaxDepth:           q.maxDepth.Load(),
+		ActiveLanes:        activeLanes,
+		Enqueued:           q.enqueued.Load(),
+		Processed:          q.processed.Load(),
+		Panics:             q.panics.Load(),
+		BackpressureHits:   q.backpressureHits.Load(),
+		BackpressureWaitMs: float64(q.backpressureWait.Load()) / float64(time.Millisecond),
+	}
+}
+
+// @Summary Get event queue metrics
+// @Description Reports the depth, throughput and backpressure of a client's event pipeline
+// @Tags clients
+// @Produce json
+// @Param id path string true "Client ID"
+// @Success 200 {object} EventQueueMetrics
+// @Failure 404 {object} map[string]string
+// @Router /clients/{id}/queue [get]
+func getEventQueueMetrics(c *gin.Context) {
+	clientID := c.Param("id")
+
+	waClient, err := manager.getClient(clientID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	metrics := waClient.events.metrics()
+	metrics.ClientID = clientID
+	c.JSON(http.StatusOK, metrics)
+}
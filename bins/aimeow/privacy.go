@@ -0,0 +1,320 @@
+package main
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+type BlockRequest struct {
+	JID string `json:"jid" binding:"required"` // Phone number or full JID
+}
+
+type BlocklistResponse struct {
+	JIDs  []string `json:"jids"`
+	DHash string   `json:"dhash,omitempty"`
+}
+
+// BlocklistChange is a single entry of a blocklist_changed webhook
+type BlocklistChange struct {
+	JID    string `json:"jid"`
+	Action string `json:"action"`
+}
+
+// PrivacySettingsResponse mirrors types.PrivacySettings with API field names
+type PrivacySettingsResponse struct {
+	LastSeen     string `json:"lastSeen"`
+	ProfilePhoto string `json:"profilePhoto"`
+	Status       string `json:"status"`
+	ReadReceipts string `json:"readReceipts"`
+	GroupsAdd    string `json:"groupsAdd"`
+	Online       string `json:"online"`
+	CallAdd      string `json:"callAdd"`
+}
+
+// UpdatePrivacySettingsRequest is a partial update; omitted settings are left unchanged
+type UpdatePrivacySettingsRequest struct {
+	LastSeen     *string `json:"lastSeen,omitempty" binding:"omitempty,oneof=all contacts contact_blacklist none"`
+	ProfilePhoto *string `json:"profilePhoto,omitempty" binding:"omitempty,oneof=all contacts contact_blacklist none"`
+	Status       *string `json:"status,omitempty" binding:"omitempty,oneof=all contacts contact_blacklist none"`
+	ReadReceipts *string `json:"readReceipts,omitempty" binding:"omitempty,oneof=all none"`
+	GroupsAdd    *string `json:"groupsAdd,omitempty" binding:"omitempty,oneof=all contacts contact_blacklist none"`
+}
+
+func newBlocklistResponse(blocklist *types.Blocklist) BlocklistResponse {
+	resp := BlocklistResponse{JIDs: make([]string, 0)}
+	if blocklist == nil {
+		return resp
+	}
+	resp.DHash = blocklist.DHash
+	for _, jid := range blocklist.JIDs {
+		resp.JIDs = append(resp.JIDs, jid.String())
+	}
+	return resp
+}
+
+func newPrivacySettingsResponse(settings types.PrivacySettings) PrivacySettingsResponse {
+	return PrivacySettingsResponse{
+		LastSeen:     string(settings.LastSeen),
+		ProfilePhoto: string(settings.Profile),
+		Status:       string(settings.Status),
+		ReadReceipts: string(settings.ReadReceipts),
+		GroupsAdd:    string(settings.GroupAdd),
+		Online:       string(settings.Online),
+		CallAdd:      string(settings.CallAdd),
+	}
+}
+
+// sendBlocklistWebhook reports blocklist changes, whether made through the API or on another device
+func (cm *ClientManager) sendBlocklistWebhook(clientID string, source string, changes []BlocklistChange) {
+	if clientID == "" || len(changes) == 0 {
+		return
+	}
+	cm.sendConnectionStatusWebhook(clientID, "blocklist_changed", BlocklistChangedData{
+		Source:  source,
+		Changes: changes,
+	})
+}
+
+// handleBlocklistEvent converts a blocklist event from WhatsApp into a webhook
+func (cm *ClientManager) handleBlocklistEvent(client *WhatsAppClient, clientID string, evt *events.Blocklist) {
+	if clientID == "" {
+		return
+	}
+
+	if evt.Action == events.BlocklistActionModify {
+		// WhatsApp only says the list changed, so send the whole list instead of a diff
+		blocklist, err := client.client.GetBlocklist(context.Background())
+		if err != nil {
+			LogClient.Error("Failed to fetch modified blocklist for client %s: %v", clientID, err)
+			return
+		}
+		LogClient.Info("Blocklist modified for client %s, sending full list", clientID)
+		jids := newBlocklistResponse(blocklist).JIDs
+		cm.sendConnectionStatusWebhook(clientID, "blocklist_changed", BlocklistChangedData{
+			Source:    "whatsapp",
+			Action:    string(evt.Action),
+			Blocklist: &jids,
+		})
+		return
+	}
+
+	changes := make([]BlocklistChange, 0, len(evt.Changes))
+	for _, change := range evt.Changes {
+		changes = append(changes, BlocklistChange{JID: change.JID.String(), Action: string(change.Action)})
+	}
+
+	LogClient.Info("Blocklist changed for client %s: %d changes", clientID, len(changes))
+	cm.sendBlocklistWebhook(clientID, "whatsapp", changes)
+}
+
+// updateBlocklist handles both the block and unblock endpoints
+func updateBlocklist(c *gin.Context, action events.BlocklistChangeAction) {
+	clientID := c.Param("id")
+
+	waClient, err := manager.getClient(clientID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !waClient.isConnected {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "client is not connected"})
+		return
+	}
+
+	var req BlockRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	jid, err := parseChatJID(clientID, req.JID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if jid.Server != types.DefaultUserServer && jid.Server != types.HiddenUserServer {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "only users can be blocked"})
+		return
+	}
+
+	blocklist, err := waClient.client.UpdateBlocklist(context.Background(), jid.ToNonAD(), action)
+	if err != nil {
+		LogClient.Error("Failed to %s %s for client %s: %v", action, jid.String(), clientID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	LogClient.Info("Client %s: %s %s", clientID, action, jid.String())
+	waClient.events.submit(eventTask{lane: clientLane, run: func() {
+		manager.sendBlocklistWebhook(clientID, "api", []BlocklistChange{{JID: jid.ToNonAD().String(), Action: string(action)}})
+	}})
+
+	c.JSON(http.StatusOK, newBlocklistResponse(blocklist))
+}
+
+// @Summary Get blocklist
+// @Description Returns the JIDs blocked by a client
+// @Tags contacts
+// @Produce json
+// @Param id path string true "Client ID"
+// @Success 200 {object} BlocklistResponse
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /clients/{id}/blocklist [get]
+func getBlocklist(c *gin.Context) {
+	waClient, err := manager.getClient(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !waClient.isConnected {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "client is not connected"})
+		return
+	}
+
+	blocklist, err := waClient.client.GetBlocklist(context.Background())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, newBlocklistResponse(blocklist))
+}
+
+// @Summary Block contact
+// @Description Blocks a contact so they can no longer message the client
+// @Tags contacts
+// @Accept json
+// @Produce json
+// @Param id path string true "Client ID"
+// @Param block body BlockRequest true "Contact to block"
+// @Success 200 {object} BlocklistResponse
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /clients/{id}/block [post]
+func blockContact(c *gin.Context) {
+	updateBlocklist(c, events.BlocklistChangeActionBlock)
+}
+
+// @Summary Unblock contact
+// @Description Removes a contact from the blocklist
+// @Tags contacts
+// @Accept json
+// @Produce json
+// @Param id path string true "Client ID"
+// @Param unblock body BlockRequest true "Contact to unblock"
+// @Success 200 {object} BlocklistResponse
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /clients/{id}/unblock [post]
+func unblockContact(c *gin.Context) {
+	updateBlocklist(c, events.BlocklistChangeActionUnblock)
+}
+
+// @Summary Get privacy settings
+// @Description Returns the privacy settings of a client's WhatsApp account
+// @Tags clients
+// @Produce json
+// @Param id path string true "Client ID"
+// @Success 200 {object} PrivacySettingsResponse
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /clients/{id}/privacy [get]
+func getPrivacySettings(c *gin.Context) {
+	waClient, err := manager.getClient(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !waClient.isConnected {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "client is not connected"})
+		return
+	}
+
+	settings, err := waClient.client.TryFetchPrivacySettings(context.Background(), true)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, newPrivacySettingsResponse(*settings))
+}
+
+// @Summary Update privacy settings
+// @Description Partially updates the privacy settings of a client's WhatsApp account; omitted settings are unchanged
+// @Tags clients
+// @Accept json
+// @Produce json
+// @Param id path string true "Client ID"
+// @Param privacy body UpdatePrivacySettingsRequest true "Settings to change"
+// @Success 200 {object} PrivacySettingsResponse
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /clients/{id}/privacy [patch]
+func updatePrivacySettings(c *gin.Context) {
+	clientID := c.Param("id")
+
+	waClient, err := manager.getClient(clientID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !waClient.isConnected {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "client is not connected"})
+		return
+	}
+
+	var req UpdatePrivacySettingsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	updates := []struct {
+		name  types.PrivacySettingType
+		value *string
+	}{
+		{types.PrivacySettingTypeLastSeen, req.LastSeen},
+		{types.PrivacySettingTypeProfile, req.ProfilePhoto},
+		{types.PrivacySettingTypeStatus, req.Status},
+		{types.PrivacySettingTypeReadReceipts, req.ReadReceipts},
+		{types.PrivacySettingTypeGroupAdd, req.GroupsAdd},
+	}
+
+	ctx := context.Background()
+	settings, err := waClient.client.TryFetchPrivacySettings(ctx, false)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	current := *settings
+
+	// WhatsApp takes one setting per request, so earlier ones stay applied if a later one fails
+	for _, update := range updates {
+		if update.value == nil {
+			continue
+		}
+		current, err = waClient.client.SetPrivacySetting(ctx, update.name, types.PrivacySetting(*update.value))
+		if err != nil {
+			LogClient.Error("Failed to set privacy setting %s for client %s: %v", update.name, clientID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "setting": string(update.name)})
+			return
+		}
+		LogClient.Info("Client %s privacy setting %s set to %s", clientID, update.name, *update.value)
+	}
+
+	c.JSON(http.StatusOK, newPrivacySettingsResponse(current))
+}
@@ -0,0 +1,381 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	_ "image/gif"
+	"image/jpeg"
+	_ "image/png"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/appstate"
+	"go.mau.fi/whatsmeow/types"
+)
+
+// Profile picture limits. WhatsApp only accepts square JPEGs and shows them at 640px.
+const (
+	profilePictureSize      = 640
+	profilePictureMaxBytes  = 10 << 20
+	profilePictureMaxPixels = 25000000 // decoding is refused above this, whatever the file size
+)
+
+// OwnProfile is the linked account's public profile as other users see it
+type OwnProfile struct {
+	PushName   string `json:"pushName"`
+	About      string `json:"about"`
+	PictureURL string `json:"pictureUrl,omitempty"`
+	PictureID  string `json:"pictureId,omitempty"`
+}
+
+// UpdateProfileRequest is a partial update; omitted fields are left unchanged
+type UpdateProfileRequest struct {
+	PushName *string `json:"pushName,omitempty" binding:"omitempty,min=1,max=25"`
+	About    *string `json:"about,omitempty" binding:"omitempty,max=139"`
+}
+
+type SetProfilePictureRequest struct {
+	ImageURL string `json:"imageUrl" binding:"required,url"`
+}
+
+// fetchOwnProfile reads the about text and profile picture of the linked account from WhatsApp
+func fetchOwnProfile(client *WhatsAppClient) (OwnProfile, error) {
+	profile := OwnProfile{PushName: client.deviceStore.PushName}
+	if client.deviceStore.ID == nil {
+		return profile, errors.New("client is not paired")
+	}
+
+	ctx := context.Background()
+	ownJID := client.deviceStore.ID.ToNonAD()
+
+	info, err := client.client.GetUserInfo(ctx, []types.JID{ownJID})
+	if err != nil {
+		return profile, fmt.Errorf("failed to get about text: %w", err)
+	}
+	profile.About = info[ownJID].Status
+
+	picture, err := client.client.GetProfilePictureInfo(ctx, ownJID, &whatsmeow.GetProfilePictureParams{Preview: false})
+	if err != nil && !errors.Is(err, whatsmeow.ErrProfilePictureNotSet) && !errors.Is(err, whatsmeow.ErrProfilePictureUnauthorized) {
+		return profile, fmt.Errorf("failed to get profile picture: %w", err)
+	}
+	if picture != nil {
+		profile.PictureURL = picture.URL
+		profile.PictureID = picture.ID
+	}
+	return profile, nil
+}
+
+// refreshOwnProfile updates the cached profile shown in ClientResponse
+func (cm *ClientManager) refreshOwnProfile(client *WhatsAppClient, clientID string) (OwnProfile, error) {
+	profile, err := fetchOwnProfile(client)
+	if err != nil {
+		LogClient.Warn("Failed to refresh profile for client %s: %v", clientID, err)
+		return profile, err
+	}
+
+	client.mutex.Lock()
+	client.profile = profile
+	client.mutex.Unlock()
+	return profile, nil
+}
+
+// prepareProfilePicture converts an image to the square JPEG WhatsApp expects,
+// cropping to the center and scaling down to profilePictureSize
+func prepareProfilePicture(data []byte) ([]byte, error) {
+	// A small file can declare a huge canvas, so check the size before decoding allocates it
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("unsupported image: %w", err)
+	}
+	if int64(config.Width)*int64(config.Height) > profilePictureMaxPixels {
+		return nil, fmt.Errorf("image is too large (%dx%d), at most %d megapixels are accepted", config.Width, config.Height, profilePictureMaxPixels/1000000)
+	}
+
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("unsupported image: %w", err)
+	}
+
+	bounds := src.Bounds()
+	side := bounds.Dx()
+	if bounds.Dy() < side {
+		side = bounds.Dy()
+	}
+	if side == 0 {
+		return nil, errors.New("image is empty")
+	}
+	offset := image.Pt(bounds.Min.X+(bounds.Dx()-side)/2, bounds.Min.Y+(bounds.Dy()-side)/2)
+
+	// JPEG has no alpha, so flatten transparent areas onto white; draw has fast paths for the common formats
+	square := image.NewRGBA(image.Rect(0, 0, side, side))
+	draw.Draw(square, square.Bounds(), image.White, image.Point{}, draw.Src)
+	draw.Draw(square, square.Bounds(), src, offset, draw.Over)
+
+	size := side
+	if size > profilePictureSize {
+		size = profilePictureSize
+	}
+
+	// Box filter: each output pixel averages the source pixels it covers
+	dst := image.NewRGBA(image.Rect(0, 0, size, size))
+	for y := 0; y < size; y++ {
+		y0, y1 := y*side/size, (y+1)*side/size
+		for x := 0; x < size; x++ {
+			x0, x1 := x*side/size, (x+1)*side/size
+			var r, g, b, n int
+			for sy := y0; sy < y1; sy++ {
+				row := square.Pix[sy*square.Stride:]
+				for sx := x0; sx < x1; sx++ {
+					r, g, b, n = r+int(row[sx*4]), g+int(row[sx*4+1]), b+int(row[sx*4+2]), n+1
+				}
+			}
+			i := dst.PixOffset(x, y)
+			dst.Pix[i], dst.Pix[i+1], dst.Pix[i+2], dst.Pix[i+3] = uint8(r/n), uint8(g/n), uint8(b/n), 0xff
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, dst, &jpeg.Options{Quality: 90}); err != nil {
+		return nil, fmt.Errorf("failed to encode picture: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// readProfilePictureInput takes the picture from a multipart "image" upload or from a JSON imageUrl
+func readProfilePictureInput(c *gin.Context) ([]byte, error) {
+	var reader io.Reader
+	if strings.HasPrefix(c.ContentType(), "multipart/") {
+		file, err := c.FormFile("image")
+		if err != nil {
+			return nil, fmt.Errorf("missing image file: %w", err)
+		}
+		f, err := file.Open()
+		if err != nil {
+			return nil, fmt.Errorf("failed to open image: %w", err)
+		}
+		defer f.Close()
+		reader = f
+	} else {
+		var req SetProfilePictureRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			return nil, err
+		}
+		fetched, err := mediaFetcher.fetch(c.Request.Context(), req.ImageURL)
+		if err != nil {
+			return nil, fmt.Errorf("failed to download image: %w", err)
+		}
+		reader = bytes.NewReader(fetched.Data)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(reader, profilePictureMaxBytes+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read image: %w", err)
+	}
+	if len(data) > profilePictureMaxBytes {
+		return nil, fmt.Errorf("image is larger than %d bytes", profilePictureMaxBytes)
+	}
+	return data, nil
+}
+
+// @Summary Get own profile
+// @Description Returns the push name, about text and profile picture of the linked account
+// @Tags profile
+// @Produce json
+// @Param id path string true "Client ID"
+// @Success 200 {object} OwnProfile
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /clients/{id}/profile [get]
+func getOwnProfile(c *gin.Context) {
+	clientID := c.Param("id")
+
+	waClient, err := manager.getClient(clientID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !waClient.isConnected {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "client is not connected"})
+		return
+	}
+
+	profile, err := manager.refreshOwnProfile(waClient, clientID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, profile)
+}
+
+// @Summary Update own profile
+// @Description Sets the push name and/or about text of the linked account
+// @Tags profile
+// @Accept json
+// @Produce json
+// @Param id path string true "Client ID"
+// @Param profile body UpdateProfileRequest true "Profile fields to change"
+// @Success 200 {object} OwnProfile
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /clients/{id}/profile [patch]
+func updateOwnProfile(c *gin.Context) {
+	clientID := c.Param("id")
+
+	waClient, err := manager.getClient(clientID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !waClient.isConnected {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "client is not connected"})
+		return
+	}
+
+	var req UpdateProfileRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx := context.Background()
+
+	if req.PushName != nil {
+		if err := waClient.client.SendAppState(ctx, appstate.BuildSettingPushName(*req.PushName)); err != nil {
+			LogClient.Error("Failed to set push name for client %s: %v", clientID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to set push name: %v", err)})
+			return
+		}
+		// The app state echo updates the store too, but don't leave a stale name if it's delayed
+		waClient.deviceStore.PushName = *req.PushName
+		if err := waClient.deviceStore.Save(ctx); err != nil {
+			LogDatabase.Warn("Failed to save push name for client %s: %v", clientID, err)
+		}
+		LogClient.Info("Client %s push name set to %s", clientID, *req.PushName)
+	}
+
+	if req.About != nil {
+		if err := waClient.client.SetStatusMessage(ctx, *req.About); err != nil {
+			LogClient.Error("Failed to set about text for client %s: %v", clientID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to set about text: %v", err)})
+			return
+		}
+		LogClient.Info("Client %s about text updated", clientID)
+	}
+
+	profile, err := manager.refreshOwnProfile(waClient, clientID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, profile)
+}
+
+// @Summary Set own profile picture
+// @Description Sets the profile picture of the linked account from a multipart "image" upload or a JSON imageUrl. The image is cropped to a square JPEG.
+// @Tags profile
+// @Accept json,mpfd
+// @Produce json
+// @Param id path string true "Client ID"
+// @Param image formData file false "Image file"
+// @Param picture body SetProfilePictureRequest false "Image URL"
+// @Success 200 {object} OwnProfile
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /clients/{id}/profile/picture [put]
+func setOwnProfilePicture(c *gin.Context) {
+	clientID := c.Param("id")
+
+	waClient, err := manager.getClient(clientID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !waClient.isConnected {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "client is not connected"})
+		return
+	}
+
+	data, err := readProfilePictureInput(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	picture, err := prepareProfilePicture(data)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// An empty JID targets the account itself
+	pictureID, err := waClient.client.SetGroupPhoto(context.Background(), types.EmptyJID, picture)
+	if err != nil {
+		LogClient.Error("Failed to set profile picture for client %s: %v", clientID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to set profile picture: %v", err)})
+		return
+	}
+	LogClient.Info("Client %s profile picture set (%s)", clientID, pictureID)
+
+	profile, err := manager.refreshOwnProfile(waClient, clientID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, profile)
+}
+
+// @Summary Remove own profile picture
+// @Description Removes the profile picture of the linked account
+// @Tags profile
+// @Produce json
+// @Param id path string true "Client ID"
+// @Success 200 {object} OwnProfile
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /clients/{id}/profile/picture [delete]
+func removeOwnProfilePicture(c *gin.Context) {
+	clientID := c.Param("id")
+
+	waClient, err := manager.getClient(clientID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !waClient.isConnected {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "client is not connected"})
+		return
+	}
+
+	if _, err := waClient.client.SetGroupPhoto(context.Background(), types.EmptyJID, nil); err != nil {
+		LogClient.Error("Failed to remove profile picture for client %s: %v", clientID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to remove profile picture: %v", err)})
+		return
+	}
+	LogClient.Info("Client %s profile picture removed", clientID)
+
+	profile, err := manager.refreshOwnProfile(waClient, clientID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, profile)
+}
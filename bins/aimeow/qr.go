@@ -0,0 +1,484 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"go.mau.fi/whatsmeow"
+	"rsc.io/qr"
+)
+
+// QR pairing events pushed to the pairing page
+const (
+	qrEventCode      = "code"
+	qrEventConnected = "connected"
+	qrEventTimeout   = "timeout"
+)
+
+// qrUpdate is a pairing state change delivered to QR subscribers
+type qrUpdate struct {
+	Event string `json:"event"`
+	Code  string `json:"code,omitempty"`
+}
+
+// encodeQR encodes a pairing code with the given pixel scale per module
+func encodeQR(code string, scale int) (*qr.Code, error) {
+	qrCode, err := qr.Encode(code, qr.L)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode QR code: %w", err)
+	}
+	if scale > 0 {
+		qrCode.Scale = scale
+	}
+	return qrCode, nil
+}
+
+// renderQRPNG renders a pairing code as a PNG image
+func renderQRPNG(code string, scale int) ([]byte, error) {
+	qrCode, err := encodeQR(code, scale)
+	if err != nil {
+		return nil, err
+	}
+	return qrCode.PNG(), nil
+}
+
+// renderQRSVG renders a pairing code as an SVG image with a 4-module quiet zone
+func renderQRSVG(code string) ([]byte, error) {
+	qrCode, err := encodeQR(code, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	const quietZone = 4
+	size := qrCode.Size + quietZone*2
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 %d %d" shape-rendering="crispEdges">`, size, size)
+	fmt.Fprintf(&buf, `<rect width="%d" height="%d" fill="#fff"/><path fill="#000" d="`, size, size)
+	for y := 0; y < qrCode.Size; y++ {
+		for x := 0; x < qrCode.Size; x++ {
+			if !qrCode.Black(x, y) {
+				continue
+			}
+			// Merge horizontal runs into a single rectangle
+			run := 1
+			for qrCode.Black(x+run, y) {
+				run++
+			}
+			fmt.Fprintf(&buf, "M%d %dh%dv1h-%dz", x+quietZone, y+quietZone, run, run)
+			x += run - 1
+		}
+	}
+	buf.WriteString(`"/></svg>`)
+	return buf.Bytes(), nil
+}
+
+// qrDataURI renders a pairing code as a PNG data URI for embedding in webhooks
+func qrDataURI(code string) (string, error) {
+	png, err := renderQRPNG(code, 8)
+	if err != nil {
+		return "", err
+	}
+	return "data:image/png;base64," + base64.StdEncoding.EncodeToString(png), nil
+}
+
+// subscribeQR registers a channel that receives pairing updates for this client
+func (wc *WhatsAppClient) subscribeQR() chan qrUpdate {
+	ch := make(chan qrUpdate, 8)
+	wc.qrMutex.Lock()
+	if wc.qrSubscribers == nil {
+		wc.qrSubscribers = make(map[chan qrUpdate]struct{})
+	}
+	wc.qrSubscribers[ch] = struct{}{}
+	wc.qrMutex.Unlock()
+	return ch
+}
+
+// unsubscribeQR removes a channel registered with subscribeQR
+func (wc *WhatsAppClient) unsubscribeQR(ch chan qrUpdate) {
+	wc.qrMutex.Lock()
+	delete(wc.qrSubscribers, ch)
+	wc.qrMutex.Unlock()
+}
+
+// publishQR delivers a pairing update to all subscribers without blocking
+func (wc *WhatsAppClient) publishQR(update qrUpdate) {
+	wc.qrMutex.Lock()
+	defer wc.qrMutex.Unlock()
+
+	for ch := range wc.qrSubscribers {
+		select {
+		case ch <- update:
+		default:
+			LogQR.Debug("Dropping QR update %s for slow subscriber", update.Event)
+		}
+	}
+}
+
+// startPairing opens the QR channel, connects the client and tracks pairing codes until it closes
+func (cm *ClientManager) startPairing(clientID string, waClient *WhatsAppClient) {
+	waClient.mutex.Lock()
+	waClient.pairing = true
+	waClient.mutex.Unlock()
+	defer func() {
+		waClient.mutex.Lock()
+		waClient.pairing = false
+		waClient.mutex.Unlock()
+	}()
+
+	qrChan, err := waClient.client.GetQRChannel(context.Background())
+	if err != nil {
+		LogQR.Error("Failed to get QR channel for client %s: %v", clientID, err)
+		return
+	}
+
+	err = waClient.client.Connect()
+	if err != nil {
+		LogClient.Error("Failed to connect client %s: %v", clientID, err)
+		return
+	}
+
+	waClient.mutex.Lock()
+	waClient.qrTimedOut = false
+	cm.setState(waClient, clientID, StatePairing, "", StateChangedData{})
+	waClient.mutex.Unlock()
+
+	for evt := range qrChan {
+		switch evt.Event {
+		case whatsmeow.QRChannelEventCode:
+			waClient.mutex.Lock()
+			waClient.qrCode = evt.Code
+			waClient.mutex.Unlock()
+			waClient.publishQR(qrUpdate{Event: qrEventCode, Code: evt.Code})
+			LogQR.Debug("QR code received for client %s", clientID)
+		case whatsmeow.QRChannelTimeout.Event:
+			// QR code expired
+			LogQR.Info("QR code expired for client %s", clientID)
+
+			waClient.mutex.Lock()
+			waClient.qrCode = ""
+			waClient.qrTimedOut = true
+			cm.setState(waClient, clientID, StateDisconnected, "qr timeout", StateChangedData{})
+			waClient.mutex.Unlock()
+			waClient.publishQR(qrUpdate{Event: qrEventTimeout})
+
+			// Send webhook for timeout, after the state change it follows
+			waClient.events.submit(eventTask{lane: clientLane, run: func() {
+				cm.sendConnectionStatusWebhook(clientID, "qr_timeout", EmptyData{})
+			}})
+		case whatsmeow.QRChannelSuccess.Event:
+			LogQR.Info("QR code scanned successfully for client %s", clientID)
+		default:
+			LogQR.Warn("Pairing event %s for client %s: %v", evt.Event, clientID, evt.Error)
+		}
+	}
+}
+
+// currentQRCode returns the client's pending pairing code or an HTTP error status
+func currentQRCode(c *gin.Context) (string, bool) {
+	waClient, err := manager.getClient(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return "", false
+	}
+
+	waClient.mutex.RLock()
+	qrCode := waClient.qrCode
+	waClient.mutex.RUnlock()
+
+	if qrCode == "" {
+		c.JSON(http.StatusNotFound, gin.H{"error": "QR code not available"})
+		return "", false
+	}
+	return qrCode, true
+}
+
+// @Summary Get QR code for client (PNG)
+// @Description Returns the current pairing QR code as a PNG image
+// @Tags clients
+// @Produce png
+// @Param id path string true "Client ID"
+// @Param scale query int false "Pixels per QR module" default(8)
+// @Success 200 {file} file "QR code image"
+// @Failure 404 {object} map[string]string
+// @Router /clients/{id}/qr.png [get]
+func getQRCodePNG(c *gin.Context) {
+	qrCode, ok := currentQRCode(c)
+	if !ok {
+		return
+	}
+
+	scale := 8
+	if s := c.Query("scale"); s != "" {
+		if parsed, err := strconv.Atoi(s); err == nil && parsed > 0 && parsed <= 32 {
+			scale = parsed
+		}
+	}
+
+	png, err := renderQRPNG(qrCode, scale)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.Data(http.StatusOK, "image/png", png)
+}
+
+// @Summary Get QR code for client (SVG)
+// @Description Returns the current pairing QR code as an SVG image
+// @Tags clients
+// @Produce image/svg+xml
+// @Param id path string true "Client ID"
+// @Success 200 {file} file "QR code image"
+// @Failure 404 {object} map[string]string
+// @Router /clients/{id}/qr.svg [get]
+func getQRCodeSVG(c *gin.Context) {
+	qrCode, ok := currentQRCode(c)
+	if !ok {
+		return
+	}
+
+	svg, err := renderQRSVG(qrCode)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.Data(http.StatusOK, "image/svg+xml", svg)
+}
+
+// @Summary Stream pairing updates
+// @Description Streams QR code, connected and timeout events as server-sent events
+// @Tags clients
+// @Produce text/event-stream
+// @Param id path string true "Client ID"
+// @Success 200 {string} string "Event stream"
+// @Failure 404 {object} map[string]string
+// @Router /clients/{id}/qr/events [get]
+func streamQREvents(c *gin.Context) {
+	waClient, err := manager.getClient(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	updates := waClient.subscribeQR()
+	defer waClient.unsubscribeQR(updates)
+
+	// Send the current state first so the page doesn't wait for the next change
+	waClient.mutex.RLock()
+	initial := qrUpdate{Event: qrEventCode, Code: waClient.qrCode}
+	if waClient.isConnected {
+		initial = qrUpdate{Event: qrEventConnected}
+	} else if waClient.qrTimedOut {
+		initial = qrUpdate{Event: qrEventTimeout}
+	}
+	waClient.mutex.RUnlock()
+
+	c.Header("Cache-Control", "no-store")
+	c.Header("X-Accel-Buffering", "no")
+	c.SSEvent(initial.Event, initial)
+	c.Writer.Flush()
+
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case update := <-updates:
+			c.SSEvent(update.Event, update)
+			return true
+		case <-c.Request.Context().Done():
+			return false
+		}
+	})
+}
+
+// @Summary Regenerate QR code
+// @Description Restarts pairing for an unpaired client whose QR codes have expired
+// @Tags clients
+// @Produce json
+// @Param id path string true "Client ID"
+// @Success 200 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Router /clients/{id}/qr/regenerate [post]
+func regenerateQRCode(c *gin.Context) {
+	clientID := c.Param("id")
+
+	waClient, err := manager.getClient(clientID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	if waClient.client.IsLoggedIn() || waClient.deviceStore.ID != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "client is already paired"})
+		return
+	}
+
+	// Check and claim under the lock so concurrent requests can't start two pairing runs.
+	// An open socket means the current QR codes are still valid.
+	waClient.mutex.Lock()
+	if waClient.pairing || waClient.client.IsConnected() {
+		waClient.mutex.Unlock()
+		c.JSON(http.StatusConflict, gin.H{"error": "pairing already in progress"})
+		return
+	}
+	waClient.pairing = true
+	waClient.qrCode = ""
+	waClient.qrTimedOut = false
+	waClient.mutex.Unlock()
+
+	go manager.startPairing(clientID, waClient)
+
+	c.JSON(http.StatusOK, gin.H{"message": "pairing restarted"})
+}
+
+// pairingPageHTML renders the live pairing page for a client
+func pairingPageHTML(clientID string) string {
+	escapedID := html.EscapeString(clientID)
+	jsID, _ := json.Marshal(clientID)
+
+	return fmt.Sprintf(`<!DOCTYPE html>
+<html>
+<head>
+    <title>WhatsApp QR Code - Client %s</title>
+    <meta name="viewport" content="width=device-width, initial-scale=1">
+    <style>
+        body { font-family: Arial, sans-serif; text-align: center; padding: 20px; }
+        .container { max-width: 600px; margin: 0 auto; }
+        .qr-code {
+            margin: 20px auto;
+            padding: 20px;
+            border: 2px solid #ddd;
+            border-radius: 10px;
+            background: white;
+            width: 280px;
+            height: 280px;
+        }
+        .qr-code img { width: 100%%; height: 100%%; image-rendering: pixelated; }
+        .info {
+            margin: 20px 0;
+            padding: 15px;
+            background: #f0f8ff;
+            border-radius: 5px;
+        }
+        .state { display: none; }
+        .state.active { display: block; }
+        .connected { background: #d4edda; color: #155724; }
+        .waiting { background: #fff3cd; color: #856404; }
+        .timeout { background: #f8d7da; color: #721c24; }
+        button {
+            padding: 10px 20px;
+            background: #25d366;
+            color: white;
+            border: none;
+            border-radius: 5px;
+            cursor: pointer;
+            font-size: 16px;
+        }
+        button:hover { background: #128c7e; }
+        button:disabled { background: #999; cursor: default; }
+    </style>
+</head>
+<body>
+    <div class="container">
+        <h1>WhatsApp QR Code</h1>
+        <div class="info">
+            <strong>Client ID:</strong> %s<br>
+            <strong>Status:</strong> <span id="status">Loading...</span>
+        </div>
+        <div id="state-waiting" class="state info waiting">
+            <h2>⏳ Waiting for QR Code...</h2>
+            <p>QR code is being generated. Please wait.</p>
+        </div>
+        <div id="state-code" class="state">
+            <div class="info">
+                <h2>📱 Scan this QR code with WhatsApp</h2>
+                <p>Open WhatsApp on your phone → Linked Devices → Link a device</p>
+            </div>
+            <div class="qr-code"><img id="qr" alt="WhatsApp pairing QR code"></div>
+        </div>
+        <div id="state-connected" class="state info connected">
+            <h2>✅ Connected Successfully!</h2>
+            <p>Your WhatsApp client is now connected and ready to use.</p>
+        </div>
+        <div id="state-timeout" class="state info timeout">
+            <h2>⌛ QR Code Expired</h2>
+            <p>The pairing window has closed. Generate a new QR code to try again.</p>
+            <button id="regenerate" onclick="regenerate()">Generate New QR Code</button>
+        </div>
+        <div class="info" style="margin-top: 30px; font-size: 14px;">
+            <p>This page updates automatically when a new QR code is issued or the connection status changes.</p>
+            <p><a href="/api/v1/clients/%s">View API details</a></p>
+        </div>
+    </div>
+    <script>
+        const clientId = %s;
+        const base = '/api/v1/clients/' + encodeURIComponent(clientId);
+        const labels = { waiting: 'Waiting for QR code', code: 'Waiting for QR scan', connected: 'Connected', timeout: 'QR code expired' };
+        let source = null;
+        let version = 0;
+
+        function show(state) {
+            for (const el of document.querySelectorAll('.state')) {
+                el.classList.toggle('active', el.id === 'state-' + state);
+            }
+            document.getElementById('status').textContent = labels[state];
+        }
+
+        function handle(update) {
+            if (update.event === 'code') {
+                if (!update.code) {
+                    show('waiting');
+                    return;
+                }
+                version++;
+                document.getElementById('qr').src = base + '/qr.svg?v=' + version;
+                show('code');
+            } else if (update.event === 'connected') {
+                show('connected');
+                if (source) source.close();
+            } else if (update.event === 'timeout') {
+                document.getElementById('regenerate').disabled = false;
+                show('timeout');
+            }
+        }
+
+        function listen() {
+            if (source) source.close();
+            source = new EventSource(base + '/qr/events');
+            for (const name of ['code', 'connected', 'timeout']) {
+                source.addEventListener(name, e => handle(JSON.parse(e.data)));
+            }
+        }
+
+        function regenerate() {
+            document.getElementById('regenerate').disabled = true;
+            show('waiting');
+            fetch(base + '/qr/regenerate', { method: 'POST' })
+                .then(response => {
+                    if (!response.ok) throw new Error('regenerate failed');
+                    listen();
+                })
+                .catch(() => {
+                    document.getElementById('regenerate').disabled = false;
+                    show('timeout');
+                });
+        }
+
+        show('waiting');
+        listen();
+    </script>
+</body>
+</html>`, escapedID, escapedID, html.EscapeString(url.PathEscape(clientID)), string(jsID))
+}
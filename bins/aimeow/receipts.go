@@ -0,0 +1,37 @@
+package main
+
+import (
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// receiptTypes maps the receipts worth reporting to their webhook names; retries,
+// server errors and the like are whatsmeow's business
+var receiptTypes = map[types.ReceiptType]string{
+	types.ReceiptTypeDelivered:  "delivered",
+	types.ReceiptTypeRead:       "read",
+	types.ReceiptTypePlayed:     "played",
+	types.ReceiptTypeReadSelf:   "read_self",
+	types.ReceiptTypePlayedSelf: "played_self",
+}
+
+// handleReceipt converts a receipt into a webhook
+func (cm *ClientManager) handleReceipt(clientID string, evt *events.Receipt) {
+	receiptType, ok := receiptTypes[evt.Type]
+	if clientID == "" || !ok {
+		return
+	}
+
+	data := ReceiptData{
+		Type:       receiptType,
+		Chat:       evt.Chat.String(),
+		Sender:     evt.Sender.ToNonAD().String(),
+		IsGroup:    evt.IsGroup,
+		MessageIDs: evt.MessageIDs,
+		Timestamp:  evt.Timestamp.Unix(),
+	}
+	if !evt.MessageSender.IsEmpty() {
+		data.MessageSender = evt.MessageSender.ToNonAD().String()
+	}
+	cm.sendConnectionStatusWebhook(clientID, "receipt", data)
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"go.mau.fi/whatsmeow/types"
+)
+
+// Codes of RecipientError
+const (
+	RecipientMissing           = "missing"
+	RecipientInvalidPhone      = "invalid_phone"
+	RecipientInvalidJID        = "invalid_jid"
+	RecipientUnsupportedServer = "unsupported_server"
+)
+
+// RecipientError explains why a recipient couldn't be resolved
+type RecipientError struct {
+	Field   string `json:"field"`
+	Value   string `json:"value"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *RecipientError) Error() string {
+	return e.Message
+}
+
+// recipientServers are the JID servers messages can be sent to, by the kind reported to callers
+var recipientServers = map[string]string{
+	types.DefaultUserServer: "user",
+	types.GroupServer:       "group",
+	types.HiddenUserServer:  "lid",
+	types.NewsletterServer:  "newsletter",
+}
+
+// defaultCountryCode is used for national numbers when a client has no country code of its own
+var defaultCountryCode = os.Getenv("DEFAULT_COUNTRY_CODE")
+
+// resolveRecipient turns a phone number ("+62 812-3456-789", "0812...", "62812...") or a
+// user, group, LID or newsletter JID into a JID
+func resolveRecipient(to string, countryCode string) (types.JID, error) {
+	to = strings.TrimSpace(to)
+	if to == "" {
+		return types.EmptyJID, &RecipientError{Value: to, Code: RecipientMissing, Message: "recipient is required"}
+	}
+
+	if !strings.Contains(to, "@") {
+		phone, err := normalizePhone(to, countryCode)
+		if err != nil {
+			return types.EmptyJID, &RecipientError{Value: to, Code: RecipientInvalidPhone, Message: "invalid phone number: " + err.Error()}
+		}
+		// Without a country code a national number would be read as an international one
+		if strings.HasPrefix(phone, "0") {
+			return types.EmptyJID, &RecipientError{Value: to, Code: RecipientInvalidPhone,
+				Message: "national number needs a country code; add one or set the defaultCountryCode setting or DEFAULT_COUNTRY_CODE"}
+		}
+		return types.NewJID(phone, types.DefaultUserServer), nil
+	}
+
+	jid, err := types.ParseJID(to)
+	if err != nil {
+		return types.EmptyJID, &RecipientError{Value: to, Code: RecipientInvalidJID, Message: "invalid JID: " + err.Error()}
+	}
+	if _, ok := recipientServers[jid.Server]; !ok {
+		return types.EmptyJID, &RecipientError{Value: to, Code: RecipientUnsupportedServer,
+			Message: "cannot send to @" + jid.Server + "; use a phone number or a user, group, LID or newsletter JID"}
+	}
+
+	switch jid.Server {
+	case types.DefaultUserServer:
+		// Phone JIDs get the same normalization as bare numbers; a device suffix is dropped
+		phone, err := normalizePhone(jid.User, "")
+		if err != nil {
+			return types.EmptyJID, &RecipientError{Value: to, Code: RecipientInvalidPhone, Message: "invalid phone number: " + err.Error()}
+		}
+		return types.NewJID(phone, types.DefaultUserServer), nil
+	case types.GroupServer:
+		if !isJIDUser(jid.User, true) {
+			return types.EmptyJID, &RecipientError{Value: to, Code: RecipientInvalidJID, Message: "invalid group JID"}
+		}
+	default:
+		if !isJIDUser(jid.User, false) {
+			return types.EmptyJID, &RecipientError{Value: to, Code: RecipientInvalidJID, Message: "invalid " + recipientServers[jid.Server] + " JID"}
+		}
+	}
+	return jid.ToNonAD(), nil
+}
+
+// isJIDUser checks that the user part of a JID is numeric; old-style group IDs contain a dash
+func isJIDUser(user string, allowDash bool) bool {
+	if user == "" {
+		return false
+	}
+	for _, r := range user {
+		if (r < '0' || r > '9') && !(allowDash && r == '-') {
+			return false
+		}
+	}
+	return true
+}
+
+// countryCodeFor returns the country code national numbers are interpreted in for a client
+func (cm *ClientManager) countryCodeFor(clientID string) string {
+	if code := cm.getClientSettings(clientID).DefaultCountryCode; code != "" {
+		return code
+	}
+	return defaultCountryCode
+}
+
+// resolveRecipientFor resolves a recipient using the client's default country code
+func (cm *ClientManager) resolveRecipientFor(clientID string, to string) (types.JID, error) {
+	return resolveRecipient(to, cm.countryCodeFor(clientID))
+}
+
+// parseChatJID accepts a phone number or a full JID for a chat, reading national numbers like send endpoints do
+func parseChatJID(clientID string, chat string) (types.JID, error) {
+	return manager.resolveRecipientFor(clientID, chat)
+}
+
+// bindRecipient resolves the "to" field of a send request, falling back to the older "phone".
+// On failure it writes a 400 with the structured error and returns false.
+func bindRecipient(c *gin.Context, clientID string, to string, phone string) (types.JID, bool) {
+	field, value := "to", to
+	if value == "" && phone != "" {
+		field, value = "phone", phone
+	}
+
+	jid, err := manager.resolveRecipientFor(clientID, value)
+	if err != nil {
+		recipientErr := err.(*RecipientError)
+		recipientErr.Field = field
+		c.JSON(http.StatusBadRequest, gin.H{"error": recipientErr.Message, "details": recipientErr})
+		return types.EmptyJID, false
+	}
+	return jid, true
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestNormalizePhone(t *testing.T) {
+	tests := []struct {
+		phone       string
+		countryCode string
+		want        string
+		wantErr     bool
+	}{
+		// International forms
+		{"628123456789", "", "628123456789", false},
+		{"+62 812-3456-789", "", "628123456789", false},
+		{"+1 (415) 555.0100", "", "14155550100", false},
+		{"00628123456789", "", "628123456789", false},
+		{"00628123456789", "44", "628123456789", false},
+		{"628123456789@s.whatsapp.net", "", "628123456789", false},
+		{"  +628123456789  ", "", "628123456789", false},
+
+		// National numbers use the country code when there is one
+		{"0812 3456 789", "62", "628123456789", false},
+		{"0812 3456 789", "", "08123456789", false},
+		{"+0812 3456 789", "62", "08123456789", false},
+
+		// Invalid
+		{"0812abc", "62", "", true},
+		{"62812#3456", "", "", true},
+		{"123456", "", "", true},
+		{"1234567890123456", "", "", true},
+		{"", "", "", true},
+	}
+
+	for _, tt := range tests {
+		got, err := normalizePhone(tt.phone, tt.countryCode)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("normalizePhone(%q, %q) error = %v, want error %v", tt.phone, tt.countryCode, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("normalizePhone(%q, %q) = %q, want %q", tt.phone, tt.countryCode, got, tt.want)
+		}
+	}
+}
+
+func TestResolveRecipient(t *testing.T) {
+	tests := []struct {
+		to          string
+		countryCode string
+		want        string
+		code        string
+	}{
+		// Phone numbers
+		{"+62 812-3456-789", "", "628123456789@s.whatsapp.net", ""},
+		{"00628123456789", "", "628123456789@s.whatsapp.net", ""},
+		{"0812 3456 789", "62", "628123456789@s.whatsapp.net", ""},
+		{"0812 3456 789", "", "", RecipientInvalidPhone},
+		{"0812abc", "62", "", RecipientInvalidPhone},
+		{"12345", "", "", RecipientInvalidPhone},
+
+		// JIDs
+		{"628123456789@s.whatsapp.net", "", "628123456789@s.whatsapp.net", ""},
+		{"628123456789:12@s.whatsapp.net", "", "628123456789@s.whatsapp.net", ""},
+		{"abc@s.whatsapp.net", "", "", RecipientInvalidPhone},
+		{"120363025246125888@g.us", "", "120363025246125888@g.us", ""},
+		{"6281234567890-1600000000@g.us", "", "6281234567890-1600000000@g.us", ""},
+		{"group@g.us", "", "", RecipientInvalidJID},
+		{"123456789012345@lid", "", "123456789012345@lid", ""},
+		{"12ab@lid", "", "", RecipientInvalidJID},
+		{"120363144038483540@newsletter", "", "120363144038483540@newsletter", ""},
+		{"status@broadcast", "", "", RecipientUnsupportedServer},
+		{"628123456789@example.com", "", "", RecipientUnsupportedServer},
+
+		// Missing
+		{"", "", "", RecipientMissing},
+		{"   ", "", "", RecipientMissing},
+	}
+
+	for _, tt := range tests {
+		jid, err := resolveRecipient(tt.to, tt.countryCode)
+		if tt.code != "" {
+			var recipientErr *RecipientError
+			if !errors.As(err, &recipientErr) {
+				t.Errorf("resolveRecipient(%q, %q) error = %v, want RecipientError %s", tt.to, tt.countryCode, err, tt.code)
+			} else if recipientErr.Code != tt.code {
+				t.Errorf("resolveRecipient(%q, %q) code = %s, want %s", tt.to, tt.countryCode, recipientErr.Code, tt.code)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("resolveRecipient(%q, %q) unexpected error: %v", tt.to, tt.countryCode, err)
+			continue
+		}
+		if jid.String() != tt.want {
+			t.Errorf("resolveRecipient(%q, %q) = %s, want %s", tt.to, tt.countryCode, jid, tt.want)
+		}
+	}
+}
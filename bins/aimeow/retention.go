@@ -0,0 +1,259 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// mediaSweepInterval is how often retention rules are enforced
+const mediaSweepInterval = time.Hour
+
+var mediaTypes = []string{"image", "video", "audio", "document"}
+
+// StorageUsage is the disk usage of one media type
+type StorageUsage struct {
+	Files int   `json:"files"`
+	Bytes int64 `json:"bytes"`
+}
+
+type StorageResponse struct {
+	ClientID            string                  `json:"clientId"`
+	TotalFiles          int                     `json:"totalFiles"`
+	TotalBytes          int64                   `json:"totalBytes"`
+	ByType              map[string]StorageUsage `json:"byType"`
+	OldestAt            *time.Time              `json:"oldestAt,omitempty"`
+	MediaMaxAgeDays     int                     `json:"mediaMaxAgeDays"`
+	MediaMaxBytes       int64                   `json:"mediaMaxBytes"`
+	MediaTypeMaxAgeDays map[string]int          `json:"mediaTypeMaxAgeDays,omitempty"`
+}
+
+// PurgeMediaRequest selects media to delete. Without any filter the client's retention rules are applied now.
+type PurgeMediaRequest struct {
+	OlderThanDays *int     `json:"olderThanDays,omitempty" binding:"omitempty,min=0"`
+	Types         []string `json:"types,omitempty" binding:"omitempty,dive,oneof=image video audio document"`
+	All           bool     `json:"all,omitempty"`
+}
+
+type PurgeMediaReport struct {
+	FilesRemoved int      `json:"filesRemoved"`
+	BytesFreed   int64    `json:"bytesFreed"`
+	Errors       []string `json:"errors,omitempty"`
+}
+
+// add records a deleted file, or the reason it couldn't be deleted
+func (r *PurgeMediaReport) add(record MediaRecord, err error) {
+	if err != nil {
+		r.Errors = append(r.Errors, err.Error())
+		return
+	}
+	r.FilesRemoved++
+	r.BytesFreed += record.Size
+}
+
+// maxAgeFor returns the retention period for a media type, or zero to keep it forever
+func (s ClientSettings) maxAgeFor(mediaType string) time.Duration {
+	days, exists := s.MediaTypeMaxAgeDays[mediaType]
+	if !exists {
+		days = s.MediaMaxAgeDays
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+// deleteMediaRecords deletes the given files and their records
+func (cm *ClientManager) deleteMediaRecords(ctx context.Context, records []MediaRecord, report *PurgeMediaReport) {
+	for _, record := range records {
+		report.add(record, cm.deleteMedia(ctx, record))
+	}
+}
+
+// enforceRetention applies a client's age and size limits
+func (cm *ClientManager) enforceRetention(ctx context.Context, clientID string) (PurgeMediaReport, error) {
+	var report PurgeMediaReport
+	settings := cm.getClientSettings(clientID)
+
+	// Age limits, per type
+	for _, mediaType := range mediaTypes {
+		maxAge := settings.maxAgeFor(mediaType)
+		if maxAge <= 0 {
+			continue
+		}
+		expired, err := cm.queryMedia(ctx, clientID, "media_type=? AND created_at<?", mediaType, time.Now().Add(-maxAge).Unix())
+		if err != nil {
+			return report, err
+		}
+		cm.deleteMediaRecords(ctx, expired, &report)
+	}
+
+	// Size quota: drop the oldest files until the client fits
+	if settings.MediaMaxBytes > 0 {
+		records, err := cm.queryMedia(ctx, clientID, "")
+		if err != nil {
+			return report, err
+		}
+		var total int64
+		for _, record := range records {
+			total += record.Size
+		}
+		for _, record := range records {
+			if total <= settings.MediaMaxBytes {
+				break
+			}
+			err := cm.deleteMedia(ctx, record)
+			report.add(record, err)
+			if err == nil {
+				total -= record.Size
+			}
+		}
+	}
+
+	if report.FilesRemoved > 0 {
+		LogMedia.Info("Retention removed %d files (%d bytes) for client %s", report.FilesRemoved, report.BytesFreed, clientID)
+	}
+	return report, nil
+}
+
+// runMediaSweeper enforces retention rules for every client periodically
+func (cm *ClientManager) runMediaSweeper() {
+	ticker := time.NewTicker(mediaSweepInterval)
+	defer ticker.Stop()
+
+	for {
+		cm.sweepMedia()
+		<-ticker.C
+	}
+}
+
+func (cm *ClientManager) sweepMedia() {
+	cm.mutex.RLock()
+	clientIDs := make([]string, 0, len(cm.clients))
+	for clientID := range cm.clients {
+		clientIDs = append(clientIDs, clientID)
+	}
+	cm.mutex.RUnlock()
+
+	ctx := context.Background()
+	for _, clientID := range clientIDs {
+		if _, err := cm.enforceRetention(ctx, clientID); err != nil {
+			LogMedia.Error("Failed to enforce media retention for client %s: %v", clientID, err)
+		}
+	}
+}
+
+// @Summary Get media storage usage
+// @Description Reports the disk space used by a client's downloaded media, by type, and its retention settings
+// @Tags files
+// @Produce json
+// @Param id path string true "Client ID"
+// @Success 200 {object} StorageResponse
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /clients/{id}/storage [get]
+func getClientStorage(c *gin.Context) {
+	clientID := c.Param("id")
+
+	if _, err := manager.getClient(clientID); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	records, err := manager.queryMedia(c.Request.Context(), clientID, "")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	settings := manager.getClientSettings(clientID)
+	resp := StorageResponse{
+		ClientID:            clientID,
+		ByType:              make(map[string]StorageUsage),
+		MediaMaxAgeDays:     settings.MediaMaxAgeDays,
+		MediaMaxBytes:       settings.MediaMaxBytes,
+		MediaTypeMaxAgeDays: settings.MediaTypeMaxAgeDays,
+	}
+	for _, mediaType := range mediaTypes {
+		resp.ByType[mediaType] = StorageUsage{}
+	}
+	for _, record := range records {
+		usage := resp.ByType[record.MediaType]
+		usage.Files++
+		usage.Bytes += record.Size
+		resp.ByType[record.MediaType] = usage
+		resp.TotalFiles++
+		resp.TotalBytes += record.Size
+	}
+	if len(records) > 0 {
+		oldest := records[0].CreatedAt
+		resp.OldestAt = &oldest
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// @Summary Purge media
+// @Description Deletes downloaded media by age and/or type, or everything with "all". Without filters the client's retention rules are applied immediately.
+// @Tags files
+// @Accept json
+// @Produce json
+// @Param id path string true "Client ID"
+// @Param purge body PurgeMediaRequest false "What to delete"
+// @Success 200 {object} PurgeMediaReport
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /clients/{id}/storage/purge [post]
+func purgeClientStorage(c *gin.Context) {
+	clientID := c.Param("id")
+
+	if _, err := manager.getClient(clientID); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	var req PurgeMediaRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	ctx := c.Request.Context()
+
+	if !req.All && req.OlderThanDays == nil && len(req.Types) == 0 {
+		report, err := manager.enforceRetention(ctx, clientID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, report)
+		return
+	}
+
+	condition := "media_type=?"
+	var cutoff []interface{}
+	if req.OlderThanDays != nil {
+		condition += " AND created_at<?"
+		cutoff = append(cutoff, time.Now().Add(-time.Duration(*req.OlderThanDays)*24*time.Hour).Unix())
+	}
+
+	selected := req.Types
+	if len(selected) == 0 {
+		selected = mediaTypes
+	}
+
+	var report PurgeMediaReport
+	for _, mediaType := range selected {
+		records, err := manager.queryMedia(ctx, clientID, condition, append([]interface{}{mediaType}, cutoff...)...)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		manager.deleteMediaRecords(ctx, records, &report)
+	}
+
+	LogMedia.Info("Purged %d files (%d bytes) for client %s", report.FilesRemoved, report.BytesFreed, clientID)
+	c.JSON(http.StatusOK, report)
+}
@@ -0,0 +1,331 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// ClientSettings controls how a single client reacts to incoming messages
+type ClientSettings struct {
+	CallbackURL            string `json:"callbackUrl,omitempty"` // Overrides the global callback URL when set
+	AutoRead               bool   `json:"autoRead"`
+	AutoTyping             bool   `json:"autoTyping"`
+	TypingTimeoutSeconds   int    `json:"typingTimeoutSeconds"`
+	IgnoreGroups           bool   `json:"ignoreGroups"`
+	IgnoreStatusBroadcasts bool   `json:"ignoreStatusBroadcasts"`
+	IgnoreOwnMessages      bool   `json:"ignoreOwnMessages"`
+	AutoDownloadMedia      bool   `json:"autoDownloadMedia"`
+	PauseOnOperatorReply   bool   `json:"pauseOnOperatorReply"` // Pause the bot in a chat when someone replies from the phone
+	PauseIdleSeconds       int    `json:"pauseIdleSeconds"`     // Paused chats resume after this long without operator activity
+	RejectCalls            bool   `json:"rejectCalls"`
+	CallRejectMessage      string `json:"callRejectMessage,omitempty"` // Text sent to the caller after rejecting a call
+
+	// Media retention; zero means keep forever / no limit
+	MediaMaxAgeDays     int            `json:"mediaMaxAgeDays"`
+	MediaMaxBytes       int64          `json:"mediaMaxBytes"`
+	MediaTypeMaxAgeDays map[string]int `json:"mediaTypeMaxAgeDays,omitempty"` // Per-type override of mediaMaxAgeDays, e.g. {"video": 7, "document": 0}
+
+	// Largest file downloaded per media type, in bytes; larger media fails with media.failed
+	MediaMaxFileBytes map[string]int64 `json:"mediaMaxFileBytes,omitempty"`
+
+	// Country calling code for national numbers (leading 0) in "to"; falls back to DEFAULT_COUNTRY_CODE
+	DefaultCountryCode string `json:"defaultCountryCode,omitempty"`
+
+	// Webhook payload version: 1 for the legacy shape, 2 for typed payloads; zero follows WEBHOOK_SCHEMA_VERSION
+	WebhookSchemaVersion int `json:"webhookSchemaVersion,omitempty"`
+}
+
+// ClientSettingsStore represents the persistent storage of per-client settings
+type ClientSettingsStore struct {
+	Clients map[string]json.RawMessage `json:"clients"` // clientID -> ClientSettings
+}
+
+// UpdateClientSettingsRequest is a partial update; omitted fields are left unchanged
+type UpdateClientSettingsRequest struct {
+	CallbackURL            *string `json:"callbackUrl,omitempty" binding:"omitempty,url"`
+	AutoRead               *bool   `json:"autoRead,omitempty"`
+	AutoTyping             *bool   `json:"autoTyping,omitempty"`
+	TypingTimeoutSeconds   *int    `json:"typingTimeoutSeconds,omitempty" binding:"omitempty,min=1,max=600"`
+	IgnoreGroups           *bool   `json:"ignoreGroups,omitempty"`
+	IgnoreStatusBroadcasts *bool   `json:"ignoreStatusBroadcasts,omitempty"`
+	IgnoreOwnMessages      *bool   `json:"ignoreOwnMessages,omitempty"`
+	AutoDownloadMedia      *bool   `json:"autoDownloadMedia,omitempty"`
+	PauseOnOperatorReply   *bool   `json:"pauseOnOperatorReply,omitempty"`
+	PauseIdleSeconds       *int    `json:"pauseIdleSeconds,omitempty" binding:"omitempty,min=1"`
+	RejectCalls            *bool   `json:"rejectCalls,omitempty"`
+	CallRejectMessage      *string `json:"callRejectMessage,omitempty" binding:"omitempty,max=1000"`
+	MediaMaxAgeDays        *int    `json:"mediaMaxAgeDays,omitempty" binding:"omitempty,min=0"`
+	MediaMaxBytes          *int64  `json:"mediaMaxBytes,omitempty" binding:"omitempty,min=0"`
+
+	// Replaces all per-type rules when present; an empty object removes them
+	MediaTypeMaxAgeDays map[string]int `json:"mediaTypeMaxAgeDays,omitempty" binding:"omitempty,dive,keys,oneof=image video audio document,endkeys,min=0"`
+
+	// Replaces all per-type size limits when present; an empty object removes them
+	MediaMaxFileBytes map[string]int64 `json:"mediaMaxFileBytes,omitempty" binding:"omitempty,dive,keys,oneof=image video audio document,endkeys,min=0"`
+
+	// An empty string falls back to DEFAULT_COUNTRY_CODE
+	DefaultCountryCode *string `json:"defaultCountryCode,omitempty" binding:"omitempty,max=4,len=0|numeric"`
+
+	// Zero falls back to WEBHOOK_SCHEMA_VERSION
+	WebhookSchemaVersion *int `json:"webhookSchemaVersion,omitempty" binding:"omitempty,oneof=0 1 2"`
+}
+
+// defaultClientSettings matches the behavior clients had before settings existed
+func defaultClientSettings() ClientSettings {
+	return ClientSettings{
+		AutoRead:             true,
+		AutoTyping:           true,
+		TypingTimeoutSeconds: 60,
+		AutoDownloadMedia:    true,
+		PauseOnOperatorReply: true,
+		PauseIdleSeconds:     30 * 60,
+	}
+}
+
+// typingTimeout returns how long the typing indicator stays on before it is cleared
+func (s ClientSettings) typingTimeout() time.Duration {
+	if s.TypingTimeoutSeconds <= 0 {
+		return 60 * time.Second
+	}
+	return time.Duration(s.TypingTimeoutSeconds) * time.Second
+}
+
+// pauseIdleTimeout returns how long a paused chat stays paused without operator activity
+func (s ClientSettings) pauseIdleTimeout() time.Duration {
+	if s.PauseIdleSeconds <= 0 {
+		return 30 * time.Minute
+	}
+	return time.Duration(s.PauseIdleSeconds) * time.Second
+}
+
+// ignores reports whether a message should be skipped entirely (no webhook, read receipt or typing)
+func (s ClientSettings) ignores(msg *events.Message) bool {
+	switch {
+	case s.IgnoreOwnMessages && msg.Info.IsFromMe:
+		return true
+	case s.IgnoreGroups && msg.Info.IsGroup:
+		return true
+	case s.IgnoreStatusBroadcasts && msg.Info.Chat == types.StatusBroadcastJID:
+		return true
+	}
+	return false
+}
+
+// loadClientSettings loads per-client settings from JSON file
+func (cm *ClientManager) loadClientSettings() error {
+	data, err := os.ReadFile(cm.clientSettingsPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			// Settings file doesn't exist yet, that's okay
+			return nil
+		}
+		return fmt.Errorf("failed to read client settings file: %w", err)
+	}
+
+	var settingsStore ClientSettingsStore
+	if err := json.Unmarshal(data, &settingsStore); err != nil {
+		return fmt.Errorf("failed to parse client settings file: %w", err)
+	}
+
+	loaded := make(map[string]ClientSettings, len(settingsStore.Clients))
+	for clientID, raw := range settingsStore.Clients {
+		// Start from defaults so fields added later get sensible values
+		settings := defaultClientSettings()
+		if err := json.Unmarshal(raw, &settings); err != nil {
+			LogConfig.Warn("Ignoring invalid settings for client %s: %v", clientID, err)
+			continue
+		}
+		loaded[clientID] = settings
+	}
+
+	cm.mutex.Lock()
+	cm.clientSettings = loaded
+	cm.mutex.Unlock()
+
+	LogConfig.Info("Client settings loaded: %d clients", len(loaded))
+	return nil
+}
+
+// saveClientSettings saves per-client settings to JSON file
+func (cm *ClientManager) saveClientSettings() error {
+	settingsStore := ClientSettingsStore{Clients: make(map[string]json.RawMessage)}
+
+	cm.mutex.RLock()
+	for clientID, settings := range cm.clientSettings {
+		raw, err := json.Marshal(settings)
+		if err != nil {
+			cm.mutex.RUnlock()
+			return fmt.Errorf("failed to marshal settings for client %s: %w", clientID, err)
+		}
+		settingsStore.Clients[clientID] = raw
+	}
+	cm.mutex.RUnlock()
+
+	data, err := json.MarshalIndent(settingsStore, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal client settings: %w", err)
+	}
+
+	// Write to temp file first, then rename for atomic operation
+	tempPath := cm.clientSettingsPath + ".tmp"
+	if err := os.WriteFile(tempPath, data, 0644); err != nil {
+		return fmt.Errorf("failed to write temp client settings file: %w", err)
+	}
+
+	if err := os.Rename(tempPath, cm.clientSettingsPath); err != nil {
+		return fmt.Errorf("failed to rename temp client settings file: %w", err)
+	}
+
+	LogConfig.Info("Client settings saved to %s", cm.clientSettingsPath)
+	return nil
+}
+
+// clientSettingsPathFor derives the settings file path from the config path
+func clientSettingsPathFor(configPath string) string {
+	return filepath.Join(filepath.Dir(configPath), "client_settings.json")
+}
+
+// getClientSettings returns the settings for a client, falling back to defaults
+func (cm *ClientManager) getClientSettings(clientID string) ClientSettings {
+	cm.mutex.RLock()
+	defer cm.mutex.RUnlock()
+
+	if settings, exists := cm.clientSettings[clientID]; exists {
+		return settings
+	}
+	return defaultClientSettings()
+}
+
+// callbackURLFor returns the webhook URL for a client: its override if set, otherwise the global one
+func (cm *ClientManager) callbackURLFor(clientID string) string {
+	cm.mutex.RLock()
+	defer cm.mutex.RUnlock()
+
+	if settings, exists := cm.clientSettings[clientID]; exists && settings.CallbackURL != "" {
+		return settings.CallbackURL
+	}
+	return cm.callbackURL
+}
+
+// @Summary Get client settings
+// @Description Returns the behavior settings for a client
+// @Tags clients
+// @Produce json
+// @Param id path string true "Client ID"
+// @Success 200 {object} ClientSettings
+// @Failure 404 {object} map[string]string
+// @Router /clients/{id}/settings [get]
+func getClientSettingsHandler(c *gin.Context) {
+	clientID := c.Param("id")
+
+	if _, err := manager.getClient(clientID); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, manager.getClientSettings(clientID))
+}
+
+// @Summary Update client settings
+// @Description Partially updates the behavior settings for a client; omitted fields are unchanged
+// @Tags clients
+// @Accept json
+// @Produce json
+// @Param id path string true "Client ID"
+// @Param settings body UpdateClientSettingsRequest true "Settings to change"
+// @Success 200 {object} ClientSettings
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /clients/{id}/settings [patch]
+func updateClientSettingsHandler(c *gin.Context) {
+	clientID := c.Param("id")
+
+	if _, err := manager.getClient(clientID); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	var req UpdateClientSettingsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	manager.mutex.Lock()
+	settings, exists := manager.clientSettings[clientID]
+	if !exists {
+		settings = defaultClientSettings()
+	}
+	if req.CallbackURL != nil {
+		settings.CallbackURL = *req.CallbackURL
+	}
+	if req.AutoRead != nil {
+		settings.AutoRead = *req.AutoRead
+	}
+	if req.AutoTyping != nil {
+		settings.AutoTyping = *req.AutoTyping
+	}
+	if req.TypingTimeoutSeconds != nil {
+		settings.TypingTimeoutSeconds = *req.TypingTimeoutSeconds
+	}
+	if req.IgnoreGroups != nil {
+		settings.IgnoreGroups = *req.IgnoreGroups
+	}
+	if req.IgnoreStatusBroadcasts != nil {
+		settings.IgnoreStatusBroadcasts = *req.IgnoreStatusBroadcasts
+	}
+	if req.IgnoreOwnMessages != nil {
+		settings.IgnoreOwnMessages = *req.IgnoreOwnMessages
+	}
+	if req.AutoDownloadMedia != nil {
+		settings.AutoDownloadMedia = *req.AutoDownloadMedia
+	}
+	if req.PauseOnOperatorReply != nil {
+		settings.PauseOnOperatorReply = *req.PauseOnOperatorReply
+	}
+	if req.PauseIdleSeconds != nil {
+		settings.PauseIdleSeconds = *req.PauseIdleSeconds
+	}
+	if req.RejectCalls != nil {
+		settings.RejectCalls = *req.RejectCalls
+	}
+	if req.CallRejectMessage != nil {
+		settings.CallRejectMessage = *req.CallRejectMessage
+	}
+	if req.MediaMaxAgeDays != nil {
+		settings.MediaMaxAgeDays = *req.MediaMaxAgeDays
+	}
+	if req.MediaMaxBytes != nil {
+		settings.MediaMaxBytes = *req.MediaMaxBytes
+	}
+	if req.MediaTypeMaxAgeDays != nil {
+		settings.MediaTypeMaxAgeDays = req.MediaTypeMaxAgeDays
+	}
+	if req.MediaMaxFileBytes != nil {
+		settings.MediaMaxFileBytes = req.MediaMaxFileBytes
+	}
+	if req.DefaultCountryCode != nil {
+		settings.DefaultCountryCode = *req.DefaultCountryCode
+	}
+	if req.WebhookSchemaVersion != nil {
+		settings.WebhookSchemaVersion = *req.WebhookSchemaVersion
+	}
+	manager.clientSettings[clientID] = settings
+	manager.mutex.Unlock()
+
+	// Save settings to persistent storage
+	if err := manager.saveClientSettings(); err != nil {
+		LogConfig.Warn("Failed to save client settings: %v", err)
+		// Don't fail the request, just log the warning
+	}
+
+	c.JSON(http.StatusOK, settings)
+}
@@ -0,0 +1,285 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	StorageLocal = "local"
+	StorageS3    = "s3"
+
+	// Ways of serving media that isn't on local disk
+	ServeModeProxy    = "proxy"
+	ServeModeRedirect = "redirect"
+
+	// presignedURLTTL is how long a redirect to the bucket stays valid
+	presignedURLTTL = 15 * time.Minute
+)
+
+var ErrMediaNotFound = errors.New("media not found in storage")
+
+// MediaStorage is where downloaded media files are kept. Keys look like "<clientID>/<file>".
+type MediaStorage interface {
+	Name() string
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+	Open(ctx context.Context, key string) (io.ReadCloser, error)
+	Delete(ctx context.Context, key string) error
+}
+
+// presigner is implemented by backends that can hand out temporary direct download URLs
+type presigner interface {
+	URL(key, fileName, contentType string, ttl time.Duration) (string, error)
+}
+
+var (
+	// mediaStorage is the backend new downloads are written to
+	mediaStorage   MediaStorage
+	mediaServeMode = ServeModeProxy
+
+	storageBackends = make(map[string]MediaStorage)
+	storageMutex    sync.Mutex
+)
+
+// LocalStorage keeps media on disk under dataDir/files
+type LocalStorage struct {
+	root string
+}
+
+func NewLocalStorage(root string) *LocalStorage {
+	return &LocalStorage{root: root}
+}
+
+func (s *LocalStorage) Name() string {
+	return StorageLocal
+}
+
+// Path returns the file a key is stored at
+func (s *LocalStorage) Path(key string) string {
+	return filepath.Join(s.root, filepath.FromSlash(key))
+}
+
+func (s *LocalStorage) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error {
+	path := s.Path(key)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create media directory: %w", err)
+	}
+
+	// Write to a temporary file first so a half-written file is never served
+	tmpPath := path + ".tmp"
+	f, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
+
+func (s *LocalStorage) Open(ctx context.Context, key string) (io.ReadCloser, error) {
+	f, err := os.Open(s.Path(key))
+	if os.IsNotExist(err) {
+		return nil, ErrMediaNotFound
+	}
+	return f, err
+}
+
+func (s *LocalStorage) Delete(ctx context.Context, key string) error {
+	if err := os.Remove(s.Path(key)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// newStorageBackend configures a backend from the environment
+func newStorageBackend(name string) (MediaStorage, error) {
+	switch name {
+	case StorageLocal:
+		return NewLocalStorage(filepath.Join(dataDir, "files")), nil
+	case StorageS3:
+		return NewS3Storage(S3Config{
+			Endpoint:  os.Getenv("S3_ENDPOINT"),
+			Region:    os.Getenv("S3_REGION"),
+			Bucket:    os.Getenv("S3_BUCKET"),
+			Prefix:    os.Getenv("S3_PREFIX"),
+			AccessKey: os.Getenv("S3_ACCESS_KEY_ID"),
+			SecretKey: os.Getenv("S3_SECRET_ACCESS_KEY"),
+			PathStyle: os.Getenv("S3_PATH_STYLE") == "true",
+		})
+	}
+	return nil, fmt.Errorf("unknown media storage backend %q", name)
+}
+
+// storageBackend returns a configured backend by name, creating it on first use
+func storageBackend(name string) (MediaStorage, error) {
+	storageMutex.Lock()
+	defer storageMutex.Unlock()
+
+	if backend, exists := storageBackends[name]; exists {
+		return backend, nil
+	}
+	backend, err := newStorageBackend(name)
+	if err != nil {
+		return nil, err
+	}
+	storageBackends[name] = backend
+	return backend, nil
+}
+
+// initMediaStorage selects the backend for new downloads from MEDIA_STORAGE and MEDIA_SERVE_MODE
+func initMediaStorage() error {
+	name := os.Getenv("MEDIA_STORAGE")
+	if name == "" {
+		name = StorageLocal
+	}
+	backend, err := storageBackend(name)
+	if err != nil {
+		return err
+	}
+	mediaStorage = backend
+
+	switch mode := os.Getenv("MEDIA_SERVE_MODE"); mode {
+	case "":
+	case ServeModeProxy, ServeModeRedirect:
+		mediaServeMode = mode
+	default:
+		return fmt.Errorf("unknown media serve mode %q", mode)
+	}
+
+	LogMedia.Info("Media storage: %s (serve mode: %s)", mediaStorage.Name(), mediaServeMode)
+	return nil
+}
+
+// contentDisposition makes clients show or save a file under its original name
+func contentDisposition(fileName string) string {
+	return mime.FormatMediaType("inline", map[string]string{"filename": fileName})
+}
+
+// serveMedia writes a media file to the response, from disk, by redirecting to the bucket, or by streaming it through
+func serveMedia(c *gin.Context, record *MediaRecord) {
+	backend, err := storageBackend(record.Backend)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if local, ok := backend.(*LocalStorage); ok {
+		c.Header("Content-Type", record.MimeType)
+		c.Header("Content-Disposition", contentDisposition(record.FileName))
+		c.File(local.Path(record.Path))
+		return
+	}
+
+	if signer, ok := backend.(presigner); ok && mediaServeMode == ServeModeRedirect {
+		url, err := signer.URL(record.Path, record.FileName, record.MimeType, presignedURLTTL)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		// The /files link is checked on every request, so caches must not reuse the bucket URL
+		c.Header("Cache-Control", "no-store")
+		c.Redirect(http.StatusFound, url)
+		return
+	}
+
+	reader, err := backend.Open(c.Request.Context(), record.Path)
+	if errors.Is(err, ErrMediaNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "file not found"})
+		return
+	} else if err != nil {
+		LogMedia.Error("Failed to open %s from %s storage: %v", record.Path, record.Backend, err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	}
+	defer reader.Close()
+
+	c.DataFromReader(http.StatusOK, record.Size, record.MimeType, reader, map[string]string{
+		"Content-Disposition": contentDisposition(record.FileName),
+	})
+}
+
+// migrateMedia copies every file stored on one backend to another and points the records at the copies
+func (cm *ClientManager) migrateMedia(ctx context.Context, from, to string, keepSource bool) (int, error) {
+	if from == to {
+		return 0, fmt.Errorf("source and destination backends are the same")
+	}
+	source, err := storageBackend(from)
+	if err != nil {
+		return 0, err
+	}
+	dest, err := storageBackend(to)
+	if err != nil {
+		return 0, err
+	}
+
+	records, err := cm.mediaOnBackend(ctx, from)
+	if err != nil {
+		return 0, err
+	}
+
+	migrated := 0
+	for _, record := range records {
+		reader, err := source.Open(ctx, record.Path)
+		if err != nil {
+			LogMedia.Error("Failed to open %s on %s: %v", record.Path, from, err)
+			continue
+		}
+		err = dest.Put(ctx, record.Path, reader, record.Size, record.MimeType)
+		reader.Close()
+		if err != nil {
+			LogMedia.Error("Failed to copy %s to %s: %v", record.Path, to, err)
+			continue
+		}
+
+		record.Backend = to
+		if err := cm.saveMedia(ctx, record); err != nil {
+			LogDatabase.Error("Failed to update media record %s: %v", record.MessageID, err)
+			continue
+		}
+
+		if !keepSource {
+			if err := source.Delete(ctx, record.Path); err != nil {
+				LogMedia.Warn("Failed to delete %s from %s after migration: %v", record.Path, from, err)
+			}
+		}
+		migrated++
+	}
+
+	LogMedia.Info("Migrated %d of %d media files from %s to %s", migrated, len(records), from, to)
+	if migrated < len(records) {
+		return migrated, fmt.Errorf("%d files could not be migrated", len(records)-migrated)
+	}
+	return migrated, nil
+}
+
+// runMigrateMediaCommand implements "aimeow migrate-media -from local -to s3 [-keep-source]"
+func runMigrateMediaCommand(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("migrate-media", flag.ContinueOnError)
+	from := flags.String("from", StorageLocal, "backend to move media from (local or s3)")
+	to := flags.String("to", StorageS3, "backend to move media to (local or s3)")
+	keepSource := flags.Bool("keep-source", false, "keep the files on the source backend")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	_, err := manager.migrateMedia(ctx, *from, *to, *keepSource)
+	return err
+}
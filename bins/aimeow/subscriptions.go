@@ -0,0 +1,557 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// Webhook event categories a subscription can filter on
+const (
+	CategoryMessages = "messages"
+	CategoryStatus   = "status"
+	CategoryReceipts = "receipts"
+	CategoryGroups   = "groups"
+	CategoryCalls    = "calls"
+)
+
+// defaultCategories are delivered when a subscription doesn't list any.
+// Receipts are left out because there are several for every message sent.
+var defaultCategories = []string{CategoryMessages, CategoryStatus, CategoryGroups, CategoryCalls}
+
+// callbackCategories are what the callback URL got before subscriptions existed; newer
+// categories are only offered through subscriptions so existing receivers see no new events
+var callbackCategories = []string{CategoryMessages, CategoryStatus, CategoryCalls}
+
+// WebhookSubscription is a named webhook destination with its own filters
+type WebhookSubscription struct {
+	ID        string   `json:"id"`
+	Name      string   `json:"name"`
+	URL       string   `json:"url"`
+	HasSecret bool     `json:"hasSecret"`
+	Events    []string `json:"events"`    // Categories; empty means all but receipts
+	ClientIDs []string `json:"clientIds"` // Empty means every client
+	Enabled   bool     `json:"enabled"`
+	CreatedAt int64    `json:"createdAt"`
+	UpdatedAt int64    `json:"updatedAt"`
+
+	secret string
+}
+
+type CreateWebhookSubscriptionRequest struct {
+	Name      string   `json:"name" binding:"required,max=100"`
+	URL       string   `json:"url" binding:"required,url,startswith=http"`
+	Secret    string   `json:"secret,omitempty" binding:"omitempty,min=16,max=256"` // Generated when omitted
+	Events    []string `json:"events,omitempty" binding:"omitempty,dive,oneof=messages status receipts groups calls"`
+	ClientIDs []string `json:"clientIds,omitempty" binding:"omitempty,dive,required"`
+	Enabled   *bool    `json:"enabled,omitempty"` // Defaults to true
+}
+
+// UpdateWebhookSubscriptionRequest is a partial update; omitted fields are left unchanged
+type UpdateWebhookSubscriptionRequest struct {
+	Name      *string  `json:"name,omitempty" binding:"omitempty,min=1,max=100"`
+	URL       *string  `json:"url,omitempty" binding:"omitempty,url,startswith=http"`
+	Secret    *string  `json:"secret,omitempty" binding:"omitempty,len=0|min=16,max=256"` // An empty string turns signing off
+	Events    []string `json:"events,omitempty" binding:"omitempty,dive,oneof=messages status receipts groups calls"`
+	ClientIDs []string `json:"clientIds,omitempty" binding:"omitempty,dive,required"`
+	Enabled   *bool    `json:"enabled,omitempty"`
+}
+
+// CreateWebhookSubscriptionResponse is the only response that carries the secret
+type CreateWebhookSubscriptionResponse struct {
+	WebhookSubscription
+	Secret string `json:"secret"`
+}
+
+type WebhookSubscriptionsResponse struct {
+	Subscriptions []WebhookSubscription `json:"subscriptions"`
+}
+
+type WebhookTestResult struct {
+	Delivered  bool   `json:"delivered"`
+	StatusCode int    `json:"statusCode,omitempty"`
+	DurationMs int64  `json:"durationMs"`
+	Error      string `json:"error,omitempty"`
+}
+
+const subscriptionSchema = `
+CREATE TABLE IF NOT EXISTS aimeow_webhook_subscriptions (
+	id         TEXT    PRIMARY KEY,
+	name       TEXT    NOT NULL UNIQUE,
+	url        TEXT    NOT NULL,
+	secret     TEXT    NOT NULL DEFAULT '',
+	events     TEXT    NOT NULL DEFAULT '[]',
+	client_ids TEXT    NOT NULL DEFAULT '[]',
+	enabled    INTEGER NOT NULL DEFAULT 1,
+	created_at INTEGER NOT NULL,
+	updated_at INTEGER NOT NULL
+)`
+
+// initWebhookSubscriptions creates the webhook subscription table
+func initWebhookSubscriptions(ctx context.Context, db *sql.DB) error {
+	if _, err := db.ExecContext(ctx, subscriptionSchema); err != nil {
+		return fmt.Errorf("failed to create webhook subscription table: %w", err)
+	}
+	return nil
+}
+
+// loadWebhookSubscriptions reads the subscriptions into memory, where webhook delivery looks them up
+func (cm *ClientManager) loadWebhookSubscriptions(ctx context.Context) error {
+	rows, err := cm.db.QueryContext(ctx, `
+		SELECT id, name, url, secret, events, client_ids, enabled, created_at, updated_at
+		FROM aimeow_webhook_subscriptions`)
+	if err != nil {
+		return fmt.Errorf("failed to load webhook subscriptions: %w", err)
+	}
+	defer rows.Close()
+
+	subscriptions := make(map[string]WebhookSubscription)
+	for rows.Next() {
+		var sub WebhookSubscription
+		var events, clientIDs string
+		if err := rows.Scan(&sub.ID, &sub.Name, &sub.URL, &sub.secret, &events, &clientIDs, &sub.Enabled, &sub.CreatedAt, &sub.UpdatedAt); err != nil {
+			return fmt.Errorf("failed to read webhook subscription: %w", err)
+		}
+		if err := json.Unmarshal([]byte(events), &sub.Events); err != nil {
+			return fmt.Errorf("invalid events of webhook subscription %s: %w", sub.ID, err)
+		}
+		if err := json.Unmarshal([]byte(clientIDs), &sub.ClientIDs); err != nil {
+			return fmt.Errorf("invalid client IDs of webhook subscription %s: %w", sub.ID, err)
+		}
+		sub.HasSecret = sub.secret != ""
+		subscriptions[sub.ID] = sub
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to load webhook subscriptions: %w", err)
+	}
+
+	cm.subscriptionsMutex.Lock()
+	cm.subscriptions = subscriptions
+	cm.subscriptionsMutex.Unlock()
+
+	LogConfig.Info("Webhook subscriptions loaded: %d", len(subscriptions))
+	return nil
+}
+
+// saveWebhookSubscription inserts or replaces a subscription in the database
+func (cm *ClientManager) saveWebhookSubscription(ctx context.Context, sub WebhookSubscription) error {
+	events, err := json.Marshal(sub.Events)
+	if err != nil {
+		return fmt.Errorf("failed to marshal events: %w", err)
+	}
+	clientIDs, err := json.Marshal(sub.ClientIDs)
+	if err != nil {
+		return fmt.Errorf("failed to marshal client IDs: %w", err)
+	}
+	_, err = cm.db.ExecContext(ctx, `
+		INSERT INTO aimeow_webhook_subscriptions (id, name, url, secret, events, client_ids, enabled, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (id) DO UPDATE SET
+			name=excluded.name, url=excluded.url, secret=excluded.secret, events=excluded.events,
+			client_ids=excluded.client_ids, enabled=excluded.enabled, updated_at=excluded.updated_at`,
+		sub.ID, sub.Name, sub.URL, sub.secret, string(events), string(clientIDs), sub.Enabled, sub.CreatedAt, sub.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to save webhook subscription: %w", err)
+	}
+	return nil
+}
+
+func (cm *ClientManager) deleteWebhookSubscription(ctx context.Context, id string) error {
+	if _, err := cm.db.ExecContext(ctx, "DELETE FROM aimeow_webhook_subscriptions WHERE id=?", id); err != nil {
+		return fmt.Errorf("failed to delete webhook subscription: %w", err)
+	}
+	return nil
+}
+
+// wants reports whether a subscription receives an event of a client
+func (sub WebhookSubscription) wants(clientID string, category string) bool {
+	if !sub.Enabled {
+		return false
+	}
+	if len(sub.ClientIDs) > 0 && !containsString(sub.ClientIDs, clientID) {
+		return false
+	}
+	if len(sub.Events) == 0 {
+		return containsString(defaultCategories, category)
+	}
+	return containsString(sub.Events, category)
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// webhookTarget is one destination of a webhook
+type webhookTarget struct {
+	name   string // for logs
+	url    string
+	secret string // signs the body when set
+}
+
+// webhookTargets returns where an event of a client is sent: its callback URL, then every matching subscription
+func (cm *ClientManager) webhookTargets(clientID string, event string) []webhookTarget {
+	category := CategoryStatus
+	if spec, ok := findWebhookEvent(event); ok {
+		category = spec.Category
+	}
+
+	var targets []webhookTarget
+	if callbackURL := cm.callbackURLFor(clientID); callbackURL != "" && containsString(callbackCategories, category) {
+		// Status events go to a sibling of the message URL
+		if event != messageWebhookEvent {
+			callbackURL = strings.TrimSuffix(callbackURL, "/") + "/status"
+		}
+		targets = append(targets, webhookTarget{name: "callback", url: callbackURL})
+	}
+
+	cm.subscriptionsMutex.RLock()
+	defer cm.subscriptionsMutex.RUnlock()
+	for _, sub := range cm.subscriptions {
+		if sub.wants(clientID, category) {
+			targets = append(targets, webhookTarget{name: sub.Name, url: sub.URL, secret: sub.secret})
+		}
+	}
+	return targets
+}
+
+// deliverWebhook posts a webhook body to every target at once. It reports whether any target
+// failed in a way a redelivery could fix (network error or 5xx).
+func (cm *ClientManager) deliverWebhook(targets []webhookTarget, event string, idempotencyKey string, body []byte) bool {
+	var wg sync.WaitGroup
+	var failed bool
+	var failedMutex sync.Mutex
+
+	for _, target := range targets {
+		wg.Add(1)
+		go func(target webhookTarget) {
+			defer wg.Done()
+			statusCode, err := postWebhook(target, idempotencyKey, body)
+			switch {
+			case err != nil:
+				LogWebhook.Error("Failed to send %s webhook to %s: %v", event, target.name, err)
+			case statusCode >= 400:
+				LogWebhook.Warn("%s webhook to %s returned error status: %d", event, target.name, statusCode)
+			default:
+				LogWebhook.Info("Successfully sent %s to %s (status: %d)", event, target.url, statusCode)
+			}
+			if err != nil || statusCode >= 500 {
+				failedMutex.Lock()
+				failed = true
+				failedMutex.Unlock()
+			}
+		}(target)
+	}
+	wg.Wait()
+	return failed
+}
+
+// webhookSignature signs a body for a subscription's receiver, which recomputes it over "<timestamp>.<body>"
+func webhookSignature(secret string, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func generateWebhookSecret() (string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(secret), nil
+}
+
+// testWebhookSubscription sends a webhook.test event to a subscription, enabled or not, and waits for the answer
+func (cm *ClientManager) testWebhookSubscription(sub WebhookSubscription) WebhookTestResult {
+	idempotencyKey := uuid.NewString()
+	body, err := json.Marshal(StatusWebhook{
+		SchemaVersion:  WebhookSchemaVersion,
+		Event:          "webhook.test",
+		IdempotencyKey: idempotencyKey,
+		Timestamp:      time.Now().Unix(),
+		Data:           WebhookTestData{SubscriptionID: sub.ID, Name: sub.Name},
+	})
+	if err != nil {
+		return WebhookTestResult{Error: err.Error()}
+	}
+
+	start := time.Now()
+	statusCode, err := postWebhook(webhookTarget{name: sub.Name, url: sub.URL, secret: sub.secret}, idempotencyKey, body)
+	result := WebhookTestResult{StatusCode: statusCode, DurationMs: time.Since(start).Milliseconds()}
+	if err != nil {
+		result.Error = err.Error()
+	} else if statusCode >= 400 {
+		result.Error = fmt.Sprintf("receiver returned status %d", statusCode)
+	} else {
+		result.Delivered = true
+	}
+	return result
+}
+
+func (cm *ClientManager) getWebhookSubscription(id string) (WebhookSubscription, error) {
+	cm.subscriptionsMutex.RLock()
+	defer cm.subscriptionsMutex.RUnlock()
+
+	sub, exists := cm.subscriptions[id]
+	if !exists {
+		return WebhookSubscription{}, errors.New("webhook subscription not found")
+	}
+	return sub, nil
+}
+
+// storeWebhookSubscription puts a saved subscription in the map deliveries read from
+func (cm *ClientManager) storeWebhookSubscription(sub WebhookSubscription) {
+	cm.subscriptionsMutex.Lock()
+	cm.subscriptions[sub.ID] = sub
+	cm.subscriptionsMutex.Unlock()
+}
+
+// subscriptionNameTaken reports whether another subscription already uses a name
+func (cm *ClientManager) subscriptionNameTaken(name string, exceptID string) bool {
+	cm.subscriptionsMutex.RLock()
+	defer cm.subscriptionsMutex.RUnlock()
+
+	for id, sub := range cm.subscriptions {
+		if id != exceptID && sub.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// @Summary List webhook subscriptions
+// @Description Lists the webhook subscriptions; secrets are never included
+// @Tags webhooks
+// @Produce json
+// @Success 200 {object} WebhookSubscriptionsResponse
+// @Router /webhooks/subscriptions [get]
+func listWebhookSubscriptions(c *gin.Context) {
+	manager.subscriptionsMutex.RLock()
+	response := WebhookSubscriptionsResponse{Subscriptions: make([]WebhookSubscription, 0, len(manager.subscriptions))}
+	for _, sub := range manager.subscriptions {
+		response.Subscriptions = append(response.Subscriptions, sub)
+	}
+	manager.subscriptionsMutex.RUnlock()
+
+	sort.Slice(response.Subscriptions, func(i, j int) bool {
+		return response.Subscriptions[i].CreatedAt < response.Subscriptions[j].CreatedAt
+	})
+	c.JSON(http.StatusOK, response)
+}
+
+// @Summary Create webhook subscription
+// @Description Adds a webhook destination with its own secret and filters. The secret is only returned here.
+// @Tags webhooks
+// @Accept json
+// @Produce json
+// @Param subscription body CreateWebhookSubscriptionRequest true "Subscription"
+// @Success 201 {object} CreateWebhookSubscriptionResponse
+// @Failure 400 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Router /webhooks/subscriptions [post]
+func createWebhookSubscription(c *gin.Context) {
+	var req CreateWebhookSubscriptionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	secret := req.Secret
+	if secret == "" {
+		var err error
+		if secret, err = generateWebhookSecret(); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate secret"})
+			return
+		}
+	}
+
+	now := time.Now().Unix()
+	sub := WebhookSubscription{
+		ID:        uuid.NewString(),
+		Name:      req.Name,
+		URL:       req.URL,
+		HasSecret: true,
+		Events:    uniqueStrings(req.Events),
+		ClientIDs: uniqueStrings(req.ClientIDs),
+		Enabled:   req.Enabled == nil || *req.Enabled,
+		CreatedAt: now,
+		UpdatedAt: now,
+		secret:    secret,
+	}
+
+	// The database is written without holding subscriptionsMutex, so deliveries aren't held up
+	manager.subscriptionWrites.Lock()
+	defer manager.subscriptionWrites.Unlock()
+
+	if manager.subscriptionNameTaken(sub.Name, "") {
+		c.JSON(http.StatusConflict, gin.H{"error": "a webhook subscription with this name already exists"})
+		return
+	}
+	if err := manager.saveWebhookSubscription(c.Request.Context(), sub); err != nil {
+		LogDatabase.Error("%v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	manager.storeWebhookSubscription(sub)
+
+	LogConfig.Info("Webhook subscription %s (%s) created for %s", sub.ID, sub.Name, sub.URL)
+	c.JSON(http.StatusCreated, CreateWebhookSubscriptionResponse{WebhookSubscription: sub, Secret: secret})
+}
+
+// @Summary Get webhook subscription
+// @Tags webhooks
+// @Produce json
+// @Param sub_id path string true "Subscription ID"
+// @Success 200 {object} WebhookSubscription
+// @Failure 404 {object} map[string]string
+// @Router /webhooks/subscriptions/{sub_id} [get]
+func getWebhookSubscriptionHandler(c *gin.Context) {
+	sub, err := manager.getWebhookSubscription(c.Param("sub_id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, sub)
+}
+
+// @Summary Update webhook subscription
+// @Description Partially updates a subscription; omitted fields are unchanged. events and clientIds replace the old lists.
+// @Tags webhooks
+// @Accept json
+// @Produce json
+// @Param sub_id path string true "Subscription ID"
+// @Param subscription body UpdateWebhookSubscriptionRequest true "Fields to change"
+// @Success 200 {object} WebhookSubscription
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Router /webhooks/subscriptions/{sub_id} [patch]
+func updateWebhookSubscription(c *gin.Context) {
+	var req UpdateWebhookSubscriptionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	manager.subscriptionWrites.Lock()
+	defer manager.subscriptionWrites.Unlock()
+
+	sub, err := manager.getWebhookSubscription(c.Param("sub_id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Name != nil {
+		if manager.subscriptionNameTaken(*req.Name, sub.ID) {
+			c.JSON(http.StatusConflict, gin.H{"error": "a webhook subscription with this name already exists"})
+			return
+		}
+		sub.Name = *req.Name
+	}
+	if req.URL != nil {
+		sub.URL = *req.URL
+	}
+	if req.Secret != nil {
+		sub.secret = *req.Secret
+		sub.HasSecret = sub.secret != ""
+	}
+	if req.Events != nil {
+		sub.Events = uniqueStrings(req.Events)
+	}
+	if req.ClientIDs != nil {
+		sub.ClientIDs = uniqueStrings(req.ClientIDs)
+	}
+	if req.Enabled != nil {
+		sub.Enabled = *req.Enabled
+	}
+	sub.UpdatedAt = time.Now().Unix()
+
+	if err := manager.saveWebhookSubscription(c.Request.Context(), sub); err != nil {
+		LogDatabase.Error("%v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	manager.storeWebhookSubscription(sub)
+
+	c.JSON(http.StatusOK, sub)
+}
+
+// @Summary Delete webhook subscription
+// @Tags webhooks
+// @Produce json
+// @Param sub_id path string true "Subscription ID"
+// @Success 200 {object} map[string]bool
+// @Failure 404 {object} map[string]string
+// @Router /webhooks/subscriptions/{sub_id} [delete]
+func deleteWebhookSubscriptionHandler(c *gin.Context) {
+	id := c.Param("sub_id")
+
+	manager.subscriptionWrites.Lock()
+	defer manager.subscriptionWrites.Unlock()
+
+	sub, err := manager.getWebhookSubscription(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err := manager.deleteWebhookSubscription(c.Request.Context(), id); err != nil {
+		LogDatabase.Error("%v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	manager.subscriptionsMutex.Lock()
+	delete(manager.subscriptions, id)
+	manager.subscriptionsMutex.Unlock()
+
+	LogConfig.Info("Webhook subscription %s (%s) deleted", id, sub.Name)
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
+
+// @Summary Test webhook subscription
+// @Description Sends a webhook.test event to the subscription's URL, even when it is disabled, and reports how the receiver answered
+// @Tags webhooks
+// @Produce json
+// @Param sub_id path string true "Subscription ID"
+// @Success 200 {object} WebhookTestResult
+// @Failure 404 {object} map[string]string
+// @Router /webhooks/subscriptions/{sub_id}/test [post]
+func testWebhookSubscriptionHandler(c *gin.Context) {
+	sub, err := manager.getWebhookSubscription(c.Param("sub_id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, manager.testWebhookSubscription(sub))
+}
+
+// uniqueStrings drops duplicates, keeping the first occurrence; nil becomes an empty list
+func uniqueStrings(values []string) []string {
+	seen := make(map[string]bool, len(values))
+	unique := make([]string, 0, len(values))
+	for _, v := range values {
+		if !seen[v] {
+			seen[v] = true
+			unique = append(unique, v)
+		}
+	}
+	return unique
+}
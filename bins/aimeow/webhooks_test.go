@@ -0,0 +1,141 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestEncodeWebhook(t *testing.T) {
+	const sent, stamp, updated = 1700000000, 1699999990, 1699990000
+	rfc3339 := func(seconds int64) string { return time.Unix(seconds, 0).Format(time.RFC3339) }
+
+	message := MessageWebhook{
+		SchemaVersion:  WebhookSchemaVersion,
+		Event:          messageWebhookEvent,
+		ClientID:       "c1",
+		IdempotencyKey: "k1",
+		Timestamp:      sent,
+		Message: MessagePayload{
+			ID:         "M1",
+			Type:       "text",
+			From:       "628123456789",
+			Timestamp:  stamp,
+			RawChat:    "628123456789@s.whatsapp.net",
+			RawSender:  "628123456789@s.whatsapp.net",
+			Resolution: JIDResolution{JID: "628123456789@s.whatsapp.net", Type: "user", Status: "resolved", UpdatedAt: updated},
+			Text:       "hi",
+		},
+	}
+	paused := StatusWebhook{
+		SchemaVersion:  WebhookSchemaVersion,
+		Event:          "chat_paused",
+		ClientID:       "c1",
+		IdempotencyKey: "k2",
+		Timestamp:      sent,
+		Data:           ChatPausedData{Chat: "628123456789@s.whatsapp.net", Reason: "operator_reply", ExpiresAt: stamp},
+	}
+	resumed := StatusWebhook{
+		SchemaVersion:  WebhookSchemaVersion,
+		Event:          "chat_resumed",
+		ClientID:       "c1",
+		IdempotencyKey: "k3",
+		Timestamp:      sent,
+		Data:           ChatResumedData{Chat: "628123456789@s.whatsapp.net", Reason: "api"},
+	}
+
+	tests := []struct {
+		name    string
+		event   string
+		payload interface{}
+		version int
+		check   func(t *testing.T, doc map[string]interface{})
+	}{
+		{"message v2 is the typed payload", messageWebhookEvent, message, WebhookSchemaVersion, func(t *testing.T, doc map[string]interface{}) {
+			wantField(t, doc, "schemaVersion", float64(WebhookSchemaVersion))
+			wantField(t, doc, "event", messageWebhookEvent)
+			wantField(t, doc, "message.timestamp", float64(stamp))
+			wantField(t, doc, "message.resolution.updatedAt", float64(updated))
+		}},
+		{"message v1 drops schemaVersion and event and formats times", messageWebhookEvent, message, WebhookSchemaLegacy, func(t *testing.T, doc map[string]interface{}) {
+			absentField(t, doc, "schemaVersion")
+			absentField(t, doc, "event")
+			wantField(t, doc, "clientId", "c1")
+			wantField(t, doc, "timestamp", float64(sent))
+			wantField(t, doc, "message.timestamp", rfc3339(stamp))
+			wantField(t, doc, "message.resolution.updatedAt", rfc3339(updated))
+			wantField(t, doc, "message.text", "hi")
+		}},
+		{"status v1 keeps the event name", "chat_paused", paused, WebhookSchemaLegacy, func(t *testing.T, doc map[string]interface{}) {
+			absentField(t, doc, "schemaVersion")
+			wantField(t, doc, "event", "chat_paused")
+			wantField(t, doc, "timestamp", float64(sent))
+			wantField(t, doc, "data.expiresAt", rfc3339(stamp))
+		}},
+		{"status v2 keeps Unix times", "chat_paused", paused, WebhookSchemaVersion, func(t *testing.T, doc map[string]interface{}) {
+			wantField(t, doc, "schemaVersion", float64(WebhookSchemaVersion))
+			wantField(t, doc, "data.expiresAt", float64(stamp))
+		}},
+		{"status v1 without times is unchanged apart from schemaVersion", "chat_resumed", resumed, WebhookSchemaLegacy, func(t *testing.T, doc map[string]interface{}) {
+			absentField(t, doc, "schemaVersion")
+			wantField(t, doc, "event", "chat_resumed")
+			wantField(t, doc, "data", map[string]interface{}{"chat": "628123456789@s.whatsapp.net", "reason": "api"})
+		}},
+		{"missing legacy time is left out", "state_changed", StatusWebhook{Event: "state_changed", Data: StateChangedData{State: "connected"}}, WebhookSchemaLegacy, func(t *testing.T, doc map[string]interface{}) {
+			absentField(t, doc, "data.nextReconnectAt")
+			wantField(t, doc, "data.state", "connected")
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body, err := encodeWebhook(tt.event, tt.payload, tt.version)
+			if err != nil {
+				t.Fatalf("encodeWebhook: %v", err)
+			}
+			var doc map[string]interface{}
+			if err := json.Unmarshal(body, &doc); err != nil {
+				t.Fatalf("invalid JSON %s: %v", body, err)
+			}
+			tt.check(t, doc)
+		})
+	}
+}
+
+// lookupField follows a dotted path through decoded JSON objects
+func lookupField(doc map[string]interface{}, path string) (interface{}, bool) {
+	var value interface{} = doc
+	start := 0
+	for i := 0; i <= len(path); i++ {
+		if i < len(path) && path[i] != '.' {
+			continue
+		}
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if value, ok = object[path[start:i]]; !ok {
+			return nil, false
+		}
+		start = i + 1
+	}
+	return value, true
+}
+
+func wantField(t *testing.T, doc map[string]interface{}, path string, expected interface{}) {
+	t.Helper()
+	got, ok := lookupField(doc, path)
+	if !ok {
+		t.Errorf("%s is missing", path)
+	} else if !reflect.DeepEqual(got, expected) {
+		t.Errorf("%s = %#v, want %#v", path, got, expected)
+	}
+}
+
+func absentField(t *testing.T, doc map[string]interface{}, path string) {
+	t.Helper()
+	if got, ok := lookupField(doc, path); ok {
+		t.Errorf("%s = %#v, want it absent", path, got)
+	}
+}